@@ -6,6 +6,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lrstanley/marill/domfinder"
 	"github.com/lrstanley/marill/scraper"
@@ -21,22 +22,57 @@ type Scan struct {
 	failed     int
 }
 
+// newFinder returns a domain finder, configured based on the user supplied
+// flags.
+func newFinder() *domfinder.Finder {
+	return &domfinder.Finder{
+		Log:          logger,
+		ApacheConfig: conf.scan.ApacheConfig,
+		Source:       conf.scan.DomainSource,
+		Root:         conf.scan.Root,
+		DockerSocket: conf.scan.DockerSocket,
+	}
+}
+
 func crawl() (*Scan, error) {
-	var err error
 	res := &Scan{}
 
 	// fetch the tests ahead of time to ensure there are no syntax errors or anything
 	res.tests = genTests()
 
 	res.crawler = &scraper.Crawler{Log: logger}
-	res.finder = &domfinder.Finder{Log: logger}
+	res.finder = newFinder()
+
+	filter, err := domainFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := requestProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, proxyRules, err := proxyConfig()
+	if err != nil {
+		return nil, err
+	}
 
-	if conf.scan.ManualList != "" {
+	if conf.scan.ManualList != "" || conf.scan.DomainsFile != "" {
 		logger.Println("manually supplied url list")
-		res.crawler.Cnf.Domains, err = parseManualList()
+		domains, err := parseManualList()
 		if err != nil {
 			return nil, NewErr{Code: ErrDomains, deepErr: err}
 		}
+
+		domains = domfinder.FilterDomains(domains, filter)
+		if len(domains) == 0 {
+			return nil, NewErr{Code: ErrNoDomainsFound}
+		}
+
+		for _, domain := range domains {
+			res.crawler.Cnf.Domains = append(res.crawler.Cnf.Domains, &scraper.Domain{URL: domain.URL, IP: domain.IP, Meta: domain.Meta()})
+		}
 	} else {
 		logger.Println("checking for running webservers")
 
@@ -57,21 +93,23 @@ func crawl() (*Scan, error) {
 			return nil, NewErr{Code: ErrGetDomains, deepErr: err}
 		}
 
-		res.finder.Filter(domfinder.DomainFilter{
-			IgnoreHTTP:  conf.scan.IgnoreHTTP,
-			IgnoreHTTPS: conf.scan.IgnoreHTTPS,
-			IgnoreMatch: conf.scan.IgnoreMatch,
-			MatchOnly:   conf.scan.MatchOnly,
-		})
+		res.finder.Filter(filter)
 
 		if len(res.finder.Domains) == 0 {
 			return nil, NewErr{Code: ErrNoDomainsFound}
 		}
 
-		logger.Printf("found %d domains on webserver %s (exe: %s, pid: %s)", len(res.finder.Domains), res.finder.MainProc.Name, res.finder.MainProc.Exe, res.finder.MainProc.PID)
+		logger.Printf("found %d domains from sources: %s", len(res.finder.Domains), strings.Join(res.finder.UsedSources, ", "))
 
 		for _, domain := range res.finder.Domains {
-			res.crawler.Cnf.Domains = append(res.crawler.Cnf.Domains, &scraper.Domain{URL: domain.URL, IP: domain.IP})
+			dom := &scraper.Domain{URL: domain.URL, IP: domain.IP, Meta: domain.Meta()}
+			if domain.Back != nil {
+				// requested through a reverse proxy; keep track of the origin
+				// so failures can be attributed to the proxy or the origin.
+				dom.Origin = &scraper.Domain{URL: domain.Back.URL, IP: domain.Back.IP}
+			}
+
+			res.crawler.Cnf.Domains = append(res.crawler.Cnf.Domains, dom)
 		}
 	}
 
@@ -80,6 +118,18 @@ func crawl() (*Scan, error) {
 	res.crawler.Cnf.Delay = conf.scan.Delay
 	res.crawler.Cnf.AllowInsecure = conf.scan.AllowInsecure
 	res.crawler.Cnf.HTTPTimeout = conf.scan.HTTPTimeout
+	res.crawler.Cnf.Spider = conf.scan.Spider
+	res.crawler.Cnf.SpiderDepth = conf.scan.SpiderDepth
+	res.crawler.Cnf.SpiderPages = conf.scan.SpiderPages
+	res.crawler.Cnf.Sitemap = conf.scan.Sitemap
+	res.crawler.Cnf.SitemapPages = conf.scan.SitemapPages
+	res.crawler.Cnf.RespectRobots = conf.scan.RespectRobots
+	res.crawler.Cnf.CheckLinks = conf.scan.CheckLinks
+	res.crawler.Cnf.LinkThreads = conf.scan.LinkThreads
+	res.crawler.Cnf.LinkTimeout = conf.scan.LinkTimeout
+	res.crawler.Cnf.Profiles = profiles
+	res.crawler.Cnf.Proxy = proxy
+	res.crawler.Cnf.ProxyRules = proxyRules
 
 	logger.Print("starting crawler...")
 	out.Printf("starting scan on %d domains", len(res.crawler.Cnf.Domains))
@@ -93,6 +143,10 @@ func crawl() (*Scan, error) {
 		for r := 0; r < len(res.crawler.Results[i].Assets); r++ {
 			logger.Printf("%s => %s", res.crawler.Results[i].URL, res.crawler.Results[i].Assets[r])
 		}
+
+		for p := 0; p < len(res.crawler.Results[i].Pages); p++ {
+			logger.Printf("%s => %s", res.crawler.Results[i].URL, res.crawler.Results[i].Pages[p])
+		}
 	}
 
 	out.Println("{lightblue}starting tests{c}")
@@ -0,0 +1,445 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+// maxApacheIncludeDepth is how deep we follow nested Include directives,
+// which prevents include loops from recursing forever.
+const maxApacheIncludeDepth = 10
+
+// apacheConfigPaths are the common locations of the main Apache configuration
+// file, used when the binary is unable to tell us where it is.
+var apacheConfigPaths = [...]string{
+	"/etc/apache2/conf/httpd.conf", // cPanel EasyApache 4
+	"/usr/local/apache/conf/httpd.conf",
+	"/etc/httpd/conf/httpd.conf",
+	"/etc/apache2/apache2.conf",
+	"/etc/apache2/httpd.conf",
+	"/usr/local/etc/apache24/httpd.conf",
+}
+
+// apacheVhost represents a <VirtualHost> block within the Apache configuration.
+type apacheVhost struct {
+	Addrs   []string // ip:port pairs the vhost is bound to
+	Names   []string // ServerName, followed by all ServerAlias entries
+	SSL     bool
+	DocRoot string
+	File    string
+	Line    int
+}
+
+func (vhost *apacheVhost) String() string {
+	return fmt.Sprintf("<[Apache vhost] addrs:%q names:%q ssl:%t file:%s:%d>", vhost.Addrs, vhost.Names, vhost.SSL, vhost.File, vhost.Line)
+}
+
+// apacheConfig holds the state of the configuration as it is being parsed.
+type apacheConfig struct {
+	fsroot  string          // filesystem root which all files are read from (see Finder.Root)
+	root    string          // ServerRoot, which relative paths are based off of
+	listens map[string]bool // ports which are configured to use SSL via "Listen"
+	ports   []string        // all ports from "Listen" directives
+	vhosts  []*apacheVhost
+	current *apacheVhost
+	seen    map[string]bool
+}
+
+func newApacheConfig(fsroot, root string) *apacheConfig {
+	return &apacheConfig{fsroot: fsroot, root: root, listens: make(map[string]bool), seen: make(map[string]bool)}
+}
+
+var reApacheDefine = regexp.MustCompile(`-D (HTTPD_ROOT|SERVER_CONFIG_FILE)="([^"]+)"`)
+
+// apacheConfigPath attempts to locate the ServerRoot and main configuration
+// file of the running Apache instance, first via "httpd -V", then by falling
+// back to common locations (within fsroot, in which case the binary isn't
+// executed).
+func apacheConfigPath(fsroot, exe string) (root, conf string) {
+	if exe != "" && fsroot == "" {
+		if out, err := execOutput(exe, "-V"); err == nil {
+			for _, match := range reApacheDefine.FindAllStringSubmatch(out, -1) {
+				if match[1] == "HTTPD_ROOT" {
+					root = match[2]
+				} else {
+					conf = match[2]
+				}
+			}
+
+			if conf != "" {
+				if !filepath.IsAbs(conf) {
+					conf = filepath.Join(root, conf)
+				}
+
+				return root, conf
+			}
+		}
+	}
+
+	for _, path := range apacheConfigPaths {
+		if _, err := os.Stat(rootPath(fsroot, path)); err == nil {
+			return "", path
+		}
+	}
+
+	return "", ""
+}
+
+// splitApacheArgs splits the arguments of an Apache directive, taking quoted
+// arguments into account.
+func splitApacheArgs(line string) (args []string) {
+	var buf []rune
+	var quote rune
+	var inArg bool
+
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			buf = append(buf, c)
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, string(buf))
+				buf = nil
+				inArg = false
+			}
+		default:
+			buf = append(buf, c)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, string(buf))
+	}
+
+	return args
+}
+
+// path returns the path relative to the ServerRoot, if it isn't absolute.
+func (c *apacheConfig) path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(c.root, path)
+}
+
+// include resolves an Include/IncludeOptional pattern into a list of files.
+// Directories include all files within them (recursively).
+func (c *apacheConfig) include(pattern string) (files []string) {
+	matches, err := filepath.Glob(rootPath(c.fsroot, c.path(pattern)))
+	if err != nil {
+		return nil
+	}
+
+	for _, match := range matches {
+		info, err := os.Stat(resolveRoot(c.fsroot, match))
+		if err != nil {
+			continue
+		}
+
+		if !info.IsDir() {
+			files = append(files, trimRoot(c.fsroot, match))
+			continue
+		}
+
+		_ = filepath.Walk(resolveRoot(c.fsroot, match), func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files = append(files, trimRoot(c.fsroot, path))
+			}
+
+			return nil
+		})
+	}
+
+	sort.Strings(files)
+
+	return files
+}
+
+// parseFile parses an Apache configuration file, following any includes.
+func (c *apacheConfig) parseFile(f *Finder, path string, depth int) error {
+	if depth > maxApacheIncludeDepth {
+		return &NewErr{Code: ErrApacheParseConfig, value: fmt.Sprintf("%s: includes nested too deep", path)}
+	}
+
+	if c.seen[path] {
+		f.Log.Printf("skipping already included apache config file %s", path)
+		return nil
+	}
+	c.seen[path] = true
+
+	file, err := os.Open(rootPath(c.fsroot, path))
+	if err != nil {
+		return &NewErr{Code: ErrApacheReadConfig, value: path, deepErr: err}
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lineNum, start int
+	var line string
+
+	for scanner.Scan() {
+		lineNum++
+		text := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			start = lineNum
+		}
+
+		// line continuations.
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+
+		line = strings.TrimSpace(line + text)
+		if line == "" || strings.HasPrefix(line, "#") {
+			line = ""
+			continue
+		}
+
+		if err := c.directive(f, path, start, line, depth); err != nil {
+			return err
+		}
+
+		line = ""
+	}
+
+	if err := scanner.Err(); err != nil {
+		return &NewErr{Code: ErrApacheReadConfig, value: path, deepErr: err}
+	}
+
+	return nil
+}
+
+// directive handles a single (joined) line of configuration.
+func (c *apacheConfig) directive(f *Finder, path string, line int, raw string, depth int) error {
+	if strings.HasPrefix(raw, "</") {
+		if strings.EqualFold(strings.Trim(raw, "</> \t"), "VirtualHost") && c.current != nil {
+			c.vhosts = append(c.vhosts, c.current)
+			c.current = nil
+		}
+
+		return nil
+	}
+
+	args := splitApacheArgs(strings.TrimSuffix(strings.TrimPrefix(raw, "<"), ">"))
+	if len(args) == 0 {
+		return nil
+	}
+	name := strings.ToLower(args[0])
+	args = args[1:]
+
+	// we don't evaluate <IfModule>, <IfDefine>, etc, and instead assume that
+	// their contents apply. the contents of everything but <VirtualHost> is
+	// otherwise irrelevant.
+	if strings.HasPrefix(raw, "<") {
+		if name == "virtualhost" {
+			if c.current != nil {
+				return &NewErr{Code: ErrApacheParseConfig, value: fmt.Sprintf("%s (line %d): nested <VirtualHost>", path, line)}
+			}
+
+			c.current = &apacheVhost{Addrs: args, File: path, Line: line}
+		}
+
+		return nil
+	}
+
+	switch name {
+	case "serverroot":
+		if len(args) > 0 && c.current == nil {
+			c.root = args[0]
+		}
+	case "include", "includeoptional":
+		if len(args) == 0 {
+			return nil
+		}
+
+		files := c.include(args[0])
+		if len(files) == 0 && name == "include" {
+			f.Log.Printf("apache Include %q (%s line %d) matched no files", args[0], path, line)
+		}
+
+		for _, file := range files {
+			if err := c.parseFile(f, file, depth+1); err != nil {
+				return err
+			}
+		}
+	case "listen":
+		if len(args) == 0 || c.current != nil {
+			return nil
+		}
+
+		port := args[0]
+		if i := strings.LastIndex(port, ":"); i > -1 {
+			port = port[i+1:]
+		}
+
+		c.ports = append(c.ports, port)
+		if len(args) > 1 && strings.EqualFold(args[1], "https") {
+			c.listens[port] = true
+		}
+	case "servername":
+		if len(args) > 0 && c.current != nil {
+			c.current.Names = append([]string{args[0]}, c.current.Names...)
+		}
+	case "serveralias":
+		if c.current != nil {
+			c.current.Names = append(c.current.Names, args...)
+		}
+	case "sslengine":
+		if len(args) > 0 && c.current != nil {
+			c.current.SSL = strings.EqualFold(args[0], "on")
+		}
+	case "documentroot":
+		if len(args) > 0 && c.current != nil {
+			c.current.DocRoot = args[0]
+		}
+	}
+
+	return nil
+}
+
+// splitApacheAddr splits a <VirtualHost> address into its ip and port,
+// defaulting to defPort if no port is supplied.
+func splitApacheAddr(addr, defPort string) (ip, port string) {
+	if strings.HasPrefix(addr, "[") {
+		// ipv6, e.g. "[2001:db8::1]:443"
+		end := strings.Index(addr, "]")
+		if end < 0 {
+			return "", ""
+		}
+
+		ip, port = addr[1:end], strings.TrimPrefix(addr[end+1:], ":")
+	} else if i := strings.LastIndex(addr, ":"); i > -1 {
+		ip, port = addr[:i], addr[i+1:]
+	} else {
+		ip = addr
+	}
+
+	if port == "" || port == "*" {
+		port = defPort
+	}
+
+	return ip, port
+}
+
+// ReadApacheConfig parses the Apache configuration tree, starting at the main
+// configuration file and following all Include/IncludeOptional directives.
+// Relative paths are based off of root (the ServerRoot), unless the
+// configuration specifies a ServerRoot itself.
+// docs: https://httpd.apache.org/docs/current/configuring.html
+func (f *Finder) ReadApacheConfig(root, conf string) ([]*Domain, error) {
+	if conf == "" {
+		return nil, &NewErr{Code: ErrApacheReadConfig, value: "(unknown)", deepErr: os.ErrNotExist}
+	}
+
+	if root == "" {
+		// the ServerRoot is commonly one level up from the config (e.g.
+		// /etc/httpd/conf/httpd.conf), or the directory of it (e.g.
+		// /etc/apache2/apache2.conf). the config itself will usually tell us
+		// if it's the former.
+		root = filepath.Dir(conf)
+	}
+
+	c := newApacheConfig(f.Root, root)
+
+	if err := c.parseFile(f, c.path(conf), 0); err != nil {
+		return nil, err
+	}
+
+	if len(c.vhosts) == 0 {
+		return nil, &NewErr{Code: ErrApacheNoEntries}
+	}
+
+	domains := f.apacheConfigDomains(c, c.vhosts)
+
+	stripDups(&domains)
+	stripPredefined(&domains)
+
+	return domains, nil
+}
+
+// apacheConfigDomains converts the parsed vhosts into domains, using the
+// Listen directives from the config to determine default ports and SSL.
+func (f *Finder) apacheConfigDomains(c *apacheConfig, vhosts []*apacheVhost) (domains []*Domain) {
+	defPort := "80"
+	if len(c.ports) > 0 {
+		defPort = c.ports[0]
+	}
+
+	// we'll want to get the hostname to test against (e.g. we want to ignore hostname urls)
+	hostname := utils.GetHostname(f.Root)
+
+	for _, vhost := range vhosts {
+		f.Log.Printf("found apache vhost: %s", vhost)
+
+		for _, addr := range vhost.Addrs {
+			ip, port := splitApacheAddr(addr, defPort)
+			if port == "" {
+				f.Log.Printf("unable to parse apache vhost address %q (%s)", addr, vhost)
+				continue
+			}
+
+			if isWildcardIP(ip) || net.ParseIP(ip) == nil {
+				ip = localIP
+			}
+
+			for _, name := range vhost.Names {
+				// ServerName supports "[scheme://]fqdn[:port]".
+				ssl := vhost.SSL || c.listens[port] || strings.HasPrefix(name, "https://")
+				name = strings.TrimPrefix(strings.TrimPrefix(name, "https://"), "http://")
+				if i := strings.Index(name, ":"); i > -1 {
+					name = name[:i]
+				}
+
+				if name == "" || name == "localhost" || utils.IsIP(name) || hostname == name {
+					continue
+				}
+
+				host := name
+				if ssl {
+					host = "https://" + name
+				}
+
+				domainURL, err := utils.IsDomainURL(host, port)
+				if err != nil {
+					f.Log.Printf("unable to parse apache domain %s (port %s): %s", name, port, err)
+					continue
+				}
+
+				domains = append(domains, &Domain{
+					IP:         ip,
+					Port:       port,
+					URL:        domainURL,
+					DocRoot:    vhost.DocRoot,
+					ConfigFile: vhost.File,
+					ConfigLine: vhost.Line,
+					Webserver:  "apache",
+				})
+			}
+		}
+	}
+
+	return domains
+}
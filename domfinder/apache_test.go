@@ -0,0 +1,122 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestReadApacheVhosts(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/apache/httpd-S.txt")
+	if err != nil {
+		t.Fatalf("unable to read fixture: %s", err)
+	}
+
+	f := &Finder{Log: log.New(ioutil.Discard, "", 0)}
+	domains, err := f.ReadApacheVhosts(string(raw))
+	if err != nil {
+		t.Fatalf("ReadApacheVhosts() returned error: %s", err)
+	}
+
+	var out []string
+	for _, dom := range domains {
+		out = append(out, dom.URL.String()+" "+dom.IP+" "+dom.Meta()["config"])
+	}
+
+	want := []string{
+		"http://example.com 10.0.0.5 /etc/apache2/conf/httpd.conf:400",
+		"http://other.example.com 10.0.0.5 /etc/apache2/conf/httpd.conf:420",
+		"https://example.com 10.0.0.5 /etc/apache2/conf/httpd.conf:500",
+		"https://v6.example.com 2001:db8::5 /etc/apache2/conf/httpd.conf:620",
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("ReadApacheVhosts() == %q, wanted %q", out, want)
+	}
+
+	return
+}
+
+func TestReadApacheConfig(t *testing.T) {
+	cases := []struct {
+		conf string
+		want []string // "url ip"; nil if an error is expected
+		code int      // error code, if one is expected
+	}{
+		{conf: "conf/httpd.conf", want: []string{
+			"http://example.com 10.0.0.5",
+			"http://www.example.com 10.0.0.5",
+			"http://quoted.example.com 10.0.0.5",
+			"https://example.com:8443 10.0.0.5",
+			"https://mixed.example.com:8080 10.0.0.5",
+			"http://plain.example.com:8080 10.0.0.5",
+			"http://other.example.org 127.0.0.1",
+			"https://secure.example.com 127.0.0.1",
+			"https://www.secure.example.com 127.0.0.1",
+			"https://alt.secure.example.com 127.0.0.1",
+		}},
+		{conf: "conf/loop.conf", want: []string{"http://loop.example.com 127.0.0.1"}},
+		{conf: "conf/nested.conf", code: ErrApacheParseConfig},
+		{conf: "conf/empty.conf", code: ErrApacheNoEntries},
+		{conf: "conf/does-not-exist.conf", code: ErrApacheReadConfig},
+		{conf: "", code: ErrApacheReadConfig},
+	}
+
+	for _, c := range cases {
+		f := &Finder{Log: log.New(ioutil.Discard, "", 0)}
+		domains, err := f.ReadApacheConfig("testdata/apache", c.conf)
+
+		if c.want == nil {
+			if err == nil {
+				t.Fatalf("ReadApacheConfig(%q) returned no error, wanted code %d", c.conf, c.code)
+			}
+
+			if code := err.(Err).GetCode(); code != c.code {
+				t.Fatalf("ReadApacheConfig(%q) == %q (code %d), wanted code %d", c.conf, err, code, c.code)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("ReadApacheConfig(%q) returned error: %s", c.conf, err)
+		}
+
+		var out []string
+		for _, dom := range domains {
+			out = append(out, dom.URL.String()+" "+dom.IP)
+		}
+
+		if !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("ReadApacheConfig(%q) == %q, wanted %q", c.conf, out, c.want)
+		}
+	}
+
+	return
+}
+
+func TestSplitApacheArgs(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{in: "ServerName example.com", want: []string{"ServerName", "example.com"}},
+		{in: `DocumentRoot "/var/www/some dir"`, want: []string{"DocumentRoot", "/var/www/some dir"}},
+		{in: "ServerAlias  a.com\tb.com 'c.com'", want: []string{"ServerAlias", "a.com", "b.com", "c.com"}},
+		{in: `Header set X ""`, want: []string{"Header", "set", "X", ""}},
+	}
+
+	for _, c := range cases {
+		out := splitApacheArgs(c.in)
+		if !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("splitApacheArgs(%q) == %q, wanted %q", c.in, out, c.want)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,319 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lrstanley/marill/utils"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// cpanelUserdataDomains is the cPanel maintained index of every domain on
+	// the server, along with its owner, type, docroot and vhost ip/port.
+	cpanelUserdataDomains = "/etc/userdatadomains"
+	// cpanelUserdata is where cPanel stores per-user vhost data, including
+	// the "main" file which lists the domains owned by each user.
+	cpanelUserdata = "/var/cpanel/userdata"
+	// cpanelUsers contains the cPanel account files (e.g. "SUSPENDED=1").
+	cpanelUsers = "/var/cpanel/users"
+	// cpanelSuspended contains a file for each suspended cPanel account.
+	cpanelSuspended = "/var/cpanel/suspended"
+)
+
+// cPanel domain types, as used within /etc/userdatadomains (and Domain.Type).
+const (
+	CpanelMain   = "main"
+	CpanelSub    = "sub"
+	CpanelAddon  = "addon"
+	CpanelParked = "parked"
+)
+
+// cpanelDomain represents a single /etc/userdatadomains entry, in the form of
+// "DOMAIN: USER==OWNER==TYPE==PARENT==DOCROOT==IP:PORT==SSLIP:SSLPORT==...".
+type cpanelDomain struct {
+	Line    int // line within /etc/userdatadomains
+	Name    string
+	User    string
+	Owner   string // reseller which owns the user
+	Type    string // see CpanelMain, CpanelSub, etc
+	Parent  string // domain the vhost belongs to (e.g. the main domain of a parked domain)
+	DocRoot string
+	IP      string
+	Port    string
+	SSLIP   string // empty if the domain doesn't have an SSL vhost
+	SSLPort string
+}
+
+func (dom *cpanelDomain) String() string {
+	return fmt.Sprintf("<[cPanel dom] user:%q type:%q parent:%q docroot:%q ip:%q port:%q sslport:%q name:%q>", dom.User, dom.Type, dom.Parent, dom.DocRoot, dom.IP, dom.Port, dom.SSLPort, dom.Name)
+}
+
+// parseCpanelUserdataDomain parses a single /etc/userdatadomains line.
+func parseCpanelUserdataDomain(line string) (*cpanelDomain, error) {
+	i := strings.Index(line, ": ")
+	if i < 1 {
+		return nil, fmt.Errorf("expected \"DOMAIN: FIELDS\", got %q", line)
+	}
+
+	fields := strings.Split(line[i+2:], "==")
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("expected at least 6 fields for %s, got %d", line[:i], len(fields))
+	}
+
+	dom := &cpanelDomain{
+		Name:    strings.ToLower(line[:i]),
+		User:    fields[0],
+		Owner:   fields[1],
+		Type:    fields[2],
+		Parent:  strings.ToLower(fields[3]),
+		DocRoot: fields[4],
+	}
+
+	var err error
+	if dom.IP, dom.Port, err = net.SplitHostPort(fields[5]); err != nil {
+		return nil, fmt.Errorf("invalid vhost ip/port for %s: %s", dom.Name, err)
+	}
+
+	if len(fields) > 6 && fields[6] != "" {
+		if dom.SSLIP, dom.SSLPort, err = net.SplitHostPort(fields[6]); err != nil {
+			return nil, fmt.Errorf("invalid SSL vhost ip/port for %s: %s", dom.Name, err)
+		}
+	}
+
+	return dom, nil
+}
+
+// readCpanelUserdataDomains reads /etc/userdatadomains, returning the
+// domains in the order they are listed.
+func (f *Finder) readCpanelUserdataDomains() ([]*cpanelDomain, error) {
+	file, err := os.Open(f.path(cpanelUserdataDomains))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var domains []*cpanelDomain
+	scanner := bufio.NewScanner(file)
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		dom, err := parseCpanelUserdataDomain(line)
+		if err != nil {
+			f.Log.Printf("unable to parse %s entry during domain search, skipping: %s", cpanelUserdataDomains, err)
+			continue
+		}
+
+		dom.Line = num
+		domains = append(domains, dom)
+	}
+
+	return domains, scanner.Err()
+}
+
+// readCpanelMain reads the userdata "main" file of a cPanel user, returning
+// the type of each domain the user owns, and the domain each addon domain is
+// attached to.
+func (f *Finder) readCpanelMain(user string) (types, addons map[string]string, err error) {
+	raw, err := ioutil.ReadFile(f.path(filepath.Join(cpanelUserdata, user, "main")))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var data struct {
+		MainDomain    string            `yaml:"main_domain"`
+		SubDomains    []string          `yaml:"sub_domains"`
+		ParkedDomains []string          `yaml:"parked_domains"`
+		AddonDomains  map[string]string `yaml:"addon_domains"` // addon domain -> subdomain
+	}
+
+	if err = yaml.Unmarshal(raw, &data); err != nil {
+		return nil, nil, err
+	}
+
+	types = make(map[string]string)
+	addons = make(map[string]string)
+
+	if data.MainDomain != "" {
+		types[data.MainDomain] = CpanelMain
+	}
+
+	for _, sub := range data.SubDomains {
+		types[sub] = CpanelSub
+	}
+
+	for _, parked := range data.ParkedDomains {
+		types[parked] = CpanelParked
+	}
+
+	for addon, sub := range data.AddonDomains {
+		types[addon] = CpanelAddon
+		addons[addon] = sub
+	}
+
+	return types, addons, nil
+}
+
+// readCpanelSuspended returns the suspended cPanel users, either from the
+// suspension markers, or the account files themselves.
+func (f *Finder) readCpanelSuspended() map[string]bool {
+	suspended := make(map[string]bool)
+
+	if markers, err := ioutil.ReadDir(f.path(cpanelSuspended)); err == nil {
+		for _, marker := range markers {
+			if !marker.IsDir() && !strings.HasPrefix(marker.Name(), ".") && !strings.HasSuffix(marker.Name(), ".lock") {
+				suspended[marker.Name()] = true
+			}
+		}
+	}
+
+	accounts, err := filepath.Glob(filepath.Join(f.path(cpanelUsers), "*"))
+	if err != nil {
+		return suspended
+	}
+
+	for _, account := range accounts {
+		raw, err := ioutil.ReadFile(account)
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(raw), "\n") {
+			if strings.TrimSpace(line) == "SUSPENDED=1" {
+				suspended[filepath.Base(account)] = true
+				break
+			}
+		}
+	}
+
+	return suspended
+}
+
+// ReadCpanelVars reads /etc/userdatadomains and the userdata "main" file of
+// each user, returning all valid domains/ports that the cPanel server is
+// hosting. Domains are labelled with their type (main, sub, addon or
+// parked), owner and document root. Domains of suspended users are skipped.
+func (f *Finder) ReadCpanelVars() ([]*Domain, error) {
+	entries, err := f.readCpanelUserdataDomains()
+	if err != nil {
+		return nil, &NewErr{Code: ErrCpanelReadUserdata, value: cpanelUserdataDomains, deepErr: err}
+	}
+
+	suspended := f.readCpanelSuspended()
+	if len(suspended) > 0 {
+		users := make([]string, 0, len(suspended))
+		for user := range suspended {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+
+		f.Log.Printf("skipping domains of suspended cPanel users: %s", strings.Join(users, ", "))
+	}
+
+	// the userdata main files are what cPanel itself considers the domains
+	// of each user, so they take precedence over the (cached) index.
+	mains := make(map[string]bool)
+	for _, entry := range entries {
+		if mains[entry.User] || suspended[entry.User] || entry.User == "nobody" {
+			continue
+		}
+		mains[entry.User] = true
+
+		types, addons, err := f.readCpanelMain(entry.User)
+		if err != nil {
+			f.Log.Printf("unable to read cPanel userdata main file for '%s', using %s: %s", entry.User, cpanelUserdataDomains, err)
+			continue
+		}
+
+		for _, dom := range entries {
+			if dom.User != entry.User {
+				continue
+			}
+
+			if types[dom.Name] == "" {
+				f.Log.Printf("cPanel domain not within the userdata main file of '%s': %s", dom.User, dom)
+				continue
+			}
+
+			dom.Type = types[dom.Name]
+			if parent := addons[dom.Name]; parent != "" {
+				dom.Parent = parent
+			}
+		}
+	}
+
+	// we'll want to get the hostname to test against (e.g. we want to ignore hostname urls)
+	hostname := utils.GetHostname(f.Root)
+
+	var domains []*Domain
+	for _, entry := range entries {
+		if entry.User == "nobody" || utils.IsIP(entry.Name) || entry.Name == hostname {
+			// assume it's an invalid user or it's an ip. we can ignore.
+			f.Log.Printf("found invalid cPanel domain during domain search, skipping: %s", entry)
+			continue
+		}
+
+		if suspended[entry.User] {
+			f.Log.Printf("cPanel user '%s' is suspended. skipping domain. (from %s)", entry.User, entry)
+			continue
+		}
+
+		f.Log.Printf("found cPanel domain: %s", entry)
+
+		hosts := []string{entry.Name}
+		if !strings.HasPrefix(entry.Name, "www.") {
+			// cPanel serves the www. form of every domain.
+			hosts = append(hosts, "www."+entry.Name)
+		}
+
+		vhosts := [][2]string{{entry.IP, entry.Port}}
+		if entry.SSLPort != "" {
+			vhosts = append(vhosts, [2]string{entry.SSLIP, entry.SSLPort})
+		}
+
+		for _, vhost := range vhosts {
+			for _, host := range hosts {
+				domainURL, err := utils.IsDomainURL(host, vhost[1])
+				if err != nil {
+					// assume the actual domain is invalid
+					f.Log.Printf("invalid uri from cPanel domain: %s (from %s)", host, entry)
+					continue
+				}
+
+				domains = append(domains, &Domain{
+					IP:         vhost[0],
+					Port:       vhost[1],
+					URL:        domainURL,
+					Type:       entry.Type,
+					User:       entry.User,
+					DocRoot:    entry.DocRoot,
+					ConfigFile: cpanelUserdataDomains,
+					ConfigLine: entry.Line,
+					Panel:      "cpanel",
+				})
+			}
+		}
+	}
+
+	if len(domains) == 0 {
+		return nil, &NewErr{Code: ErrCpanelNoEntries}
+	}
+
+	stripDups(&domains)
+	stripPredefined(&domains)
+
+	return domains, nil
+}
@@ -0,0 +1,206 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+// directadminUsers is where DirectAdmin stores per-user configuration.
+const directadminUsers = "/usr/local/directadmin/data/users"
+
+// directadminDomain represents a domain owned by a DirectAdmin user.
+type directadminDomain struct {
+	Name    string
+	User    string
+	IP      string
+	SSL     bool
+	Aliases []string // subdomains and domain pointers of type "alias"
+}
+
+func (dom *directadminDomain) String() string {
+	return fmt.Sprintf("<[DirectAdmin dom] user:%q ip:%q ssl:%t name:%q aliases:%q>", dom.User, dom.IP, dom.SSL, dom.Name, dom.Aliases)
+}
+
+// readDirectAdminConf reads a DirectAdmin "key=value" configuration file
+// (e.g. user.conf or domains/<domain>.conf).
+func readDirectAdminConf(path string) (map[string]string, error) {
+	conf := make(map[string]string)
+
+	lines, err := readDirectAdminList(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		if i := strings.Index(line, "="); i > 0 {
+			conf[line[:i]] = line[i+1:]
+		}
+	}
+
+	return conf, nil
+}
+
+// readDirectAdminList reads a file with one entry per line (e.g.
+// domains.list or <domain>.subdomains), ignoring empty lines.
+func readDirectAdminList(path string) (out []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			out = append(out, line)
+		}
+	}
+
+	return out, scanner.Err()
+}
+
+// ReadDirectAdminUsers crawls through /usr/local/directadmin/data/users/ and
+// returns all valid domains/ports that the DirectAdmin server is hosting.
+func (f *Finder) ReadDirectAdminUsers() ([]*Domain, error) {
+	return f.readDirectAdminUsers(f.path(directadminUsers))
+}
+
+func (f *Finder) readDirectAdminUsers(dir string) ([]*Domain, error) {
+	lists, err := filepath.Glob(filepath.Join(dir, "*", "domains.list"))
+	if err != nil {
+		return nil, err
+	}
+
+	// we'll want to get the hostname to test against (e.g. we want to ignore hostname urls)
+	hostname := utils.GetHostname(f.Root)
+
+	var domains []*Domain
+	for _, list := range lists {
+		userDir := filepath.Dir(list)
+		user := filepath.Base(userDir)
+
+		userConf, err := readDirectAdminConf(filepath.Join(userDir, "user.conf"))
+		if err != nil {
+			f.Log.Printf("unable to read DirectAdmin user config for '%s' during domain search, skipping: %s", user, err)
+			continue
+		}
+
+		if userConf["suspended"] == "yes" {
+			f.Log.Printf("DirectAdmin user '%s' is suspended. skipping domains.", user)
+			continue
+		}
+
+		names, err := readDirectAdminList(list)
+		if err != nil {
+			f.Log.Printf("unable to read file '%s' during domain search: %s", list, err)
+			continue
+		}
+
+		for _, name := range names {
+			dom, err := f.readDirectAdminDomain(userDir, user, name, userConf["ip"])
+			if err != nil {
+				f.Log.Printf("unable to read DirectAdmin domain '%s' (user '%s') during domain search, skipping: %s", name, user, err)
+				continue
+			}
+
+			if dom == nil {
+				continue
+			}
+
+			f.Log.Printf("found DirectAdmin domain: %s", dom)
+
+			ports := []string{"80"}
+			if dom.SSL {
+				ports = append(ports, "443")
+			}
+
+			for _, port := range ports {
+				for _, host := range append([]string{dom.Name}, dom.Aliases...) {
+					if utils.IsIP(host) || host == hostname {
+						continue
+					}
+
+					domainURL, err := utils.IsDomainURL(host, port)
+					if err != nil {
+						f.Log.Printf("invalid uri from DirectAdmin domain: %s (from %s)", host, dom)
+						continue
+					}
+
+					domains = append(domains, &Domain{
+						IP:    dom.IP,
+						Port:  port,
+						URL:   domainURL,
+						User:  dom.User,
+						Panel: "directadmin",
+					})
+				}
+			}
+		}
+	}
+
+	stripDups(&domains)
+	stripPredefined(&domains)
+
+	return domains, nil
+}
+
+// readDirectAdminDomain reads the configuration of a single domain owned by
+// user. nil is returned if the domain is suspended or inactive.
+func (f *Finder) readDirectAdminDomain(userDir, user, name, userIP string) (*directadminDomain, error) {
+	base := filepath.Join(userDir, "domains", name)
+
+	conf, err := readDirectAdminConf(base + ".conf")
+	if err != nil {
+		return nil, err
+	}
+
+	if conf["suspended"] == "yes" || conf["active"] == "no" {
+		f.Log.Printf("DirectAdmin domain '%s' (user '%s') is suspended or inactive. skipping.", name, user)
+		return nil, nil
+	}
+
+	dom := &directadminDomain{
+		Name: name,
+		User: user,
+		IP:   userIP,
+		SSL:  strings.EqualFold(conf["ssl"], "on"),
+	}
+
+	// the first entry of the ip list is the primary ip of the domain.
+	if ips, err := readDirectAdminList(base + ".ip_list"); err == nil && len(ips) > 0 {
+		dom.IP = ips[0]
+	} else if conf["ip"] != "" {
+		dom.IP = conf["ip"]
+	}
+
+	if dom.IP == "" {
+		return nil, errors.New("unable to determine ip")
+	}
+
+	subdomains, _ := readDirectAdminList(base + ".subdomains")
+	for _, sub := range subdomains {
+		dom.Aliases = append(dom.Aliases, sub+"."+name)
+	}
+
+	// pointers are in the format "<domain>=type=<alias|pointer>". older
+	// versions only list the domain, and are treated as pointers. pointers
+	// just redirect to the main domain, so only aliases are included.
+	pointers, _ := readDirectAdminList(base + ".pointers")
+	for _, pointer := range pointers {
+		if i := strings.Index(pointer, "="); i > 0 && strings.TrimPrefix(pointer[i:], "=type=") == "alias" {
+			dom.Aliases = append(dom.Aliases, pointer[:i])
+		}
+	}
+
+	return dom, nil
+}
@@ -0,0 +1,383 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+// dockerSocket is the default path to the Docker Engine API socket.
+const dockerSocket = "/var/run/docker.sock"
+
+// dockerTimeout is how long we wait for the Docker Engine API to respond.
+const dockerTimeout = 10 * time.Second
+
+// dockerProxyImages are the (partial) image names of reverse proxies which
+// route requests to containers based on their labels/environment.
+var dockerProxyImages = [...]string{"traefik", "nginx-proxy"}
+
+// dockerContainer represents the subset of "GET /containers/{id}/json" which
+// we need.
+// docs: https://docs.docker.com/engine/api/v1.24/#inspect-a-container
+type dockerContainer struct {
+	ID    string `json:"Id"`
+	Name  string
+	State struct {
+		Running bool
+	}
+	Config struct {
+		Image  string
+		Env    []string
+		Labels map[string]string
+	}
+	NetworkSettings struct {
+		Ports map[string][]dockerBinding
+	}
+}
+
+// dockerBinding is a container port published on the host.
+type dockerBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string
+}
+
+func (c *dockerContainer) String() string {
+	return fmt.Sprintf("<[Docker container] id:%.12s name:%q image:%q>", c.ID, c.Name, c.Config.Image)
+}
+
+// env returns the value of the environment variable (or label, if it isn't
+// set in the environment) of the container.
+func (c *dockerContainer) env(name string) string {
+	for _, env := range c.Config.Env {
+		if strings.HasPrefix(env, name+"=") {
+			return strings.TrimPrefix(env, name+"=")
+		}
+	}
+
+	return c.Config.Labels[name]
+}
+
+// isProxy returns true if the container is a reverse proxy which routes to
+// other containers (e.g. Traefik, or nginx-proxy).
+func (c *dockerContainer) isProxy() bool {
+	for _, image := range dockerProxyImages {
+		if strings.Contains(c.Config.Image, image) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dockerEntry is the host ip/port which a scheme is published on.
+type dockerEntry struct {
+	IP   string
+	Port string
+}
+
+// dockerClient returns an http client which connects to the Docker Engine
+// API over the unix socket.
+func dockerClient(socket string) *http.Client {
+	return &http.Client{
+		Timeout: dockerTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// dockerGet queries the Docker Engine API, decoding the JSON response into out.
+func dockerGet(client *http.Client, path string, out interface{}) error {
+	resp, err := client.Get("http://docker" + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", path, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// dockerSocketPath returns the Docker Engine API socket which should be used.
+func (f *Finder) dockerSocketPath() string {
+	if f.DockerSocket != "" {
+		return f.DockerSocket
+	}
+
+	return dockerSocket
+}
+
+// dockerPublished returns true if any running container has port 80 or 443
+// published on the host (or is published from port 80 or 443 within the
+// container, e.g. a reverse proxy on :8000).
+func dockerPublished(socket string) bool {
+	var list []struct {
+		Ports []struct {
+			PrivatePort int64
+			PublicPort  int64
+		}
+	}
+	if err := dockerGet(dockerClient(socket), "/containers/json", &list); err != nil {
+		return false
+	}
+
+	for _, container := range list {
+		for _, port := range container.Ports {
+			if port.PublicPort > 0 && (isPublicPort(port.PublicPort) || isPublicPort(port.PrivatePort)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ReadDockerContainers queries the Docker Engine API for running containers,
+// returning the domains they are routed by, via Traefik router rules
+// (labels), or the nginx-proxy VIRTUAL_HOST variable.
+func (f *Finder) ReadDockerContainers() ([]*Domain, error) {
+	socket := f.dockerSocketPath()
+	client := dockerClient(socket)
+
+	var list []struct {
+		ID string `json:"Id"`
+	}
+	if err := dockerGet(client, "/containers/json", &list); err != nil {
+		return nil, &NewErr{Code: ErrDockerFetch, value: socket, deepErr: err}
+	}
+
+	var containers []*dockerContainer
+	for _, item := range list {
+		container := &dockerContainer{}
+		if err := dockerGet(client, "/containers/"+item.ID+"/json", container); err != nil {
+			return nil, &NewErr{Code: ErrDockerFetch, value: socket, deepErr: err}
+		}
+
+		if !container.State.Running {
+			continue
+		}
+
+		containers = append(containers, container)
+	}
+
+	domains := f.dockerDomains(containers)
+	if len(domains) == 0 {
+		return nil, &NewErr{Code: ErrDockerNoEntries}
+	}
+
+	stripDups(&domains)
+	stripPredefined(&domains)
+
+	return domains, nil
+}
+
+// dockerEntries returns the host ip/port which http and https requests are
+// published on. Ports published by a reverse proxy container are preferred,
+// falling back to any container published on the host on port 80/443.
+func dockerEntries(containers []*dockerContainer) map[string]*dockerEntry {
+	entries := make(map[string]*dockerEntry)
+	schemes := map[string]string{"80": "http", "443": "https"}
+
+	for _, proxies := range []bool{true, false} {
+		for _, container := range containers {
+			if container.isProxy() != proxies {
+				continue
+			}
+
+			ports := make([]string, 0, len(container.NetworkSettings.Ports))
+			for port := range container.NetworkSettings.Ports {
+				ports = append(ports, port)
+			}
+			sort.Strings(ports)
+
+			for _, port := range ports {
+				for _, binding := range container.NetworkSettings.Ports[port] {
+					// proxy containers are matched on the port within the
+					// container, anything else on the port of the host.
+					scheme := schemes[binding.HostPort]
+					if proxies {
+						scheme = schemes[strings.TrimSuffix(port, "/tcp")]
+					}
+
+					if scheme == "" || entries[scheme] != nil {
+						continue
+					}
+
+					ip := binding.HostIP
+					if isWildcardIP(ip) {
+						ip = localIP
+					}
+
+					entries[scheme] = &dockerEntry{IP: ip, Port: binding.HostPort}
+				}
+			}
+		}
+	}
+
+	if entries["http"] == nil {
+		entries["http"] = &dockerEntry{IP: localIP, Port: "80"}
+	}
+
+	if entries["https"] == nil {
+		entries["https"] = &dockerEntry{IP: localIP, Port: "443"}
+	}
+
+	return entries
+}
+
+// reTraefikHost matches the hosts within a Traefik v2+ rule, e.g.
+// "Host(`example.com`, `www.example.com`) && PathPrefix(`/`)".
+var reTraefikHost = regexp.MustCompile("Host\\(([^)]*)\\)")
+
+// traefikRuleHosts returns the hosts within a Traefik router (v2+) or
+// frontend (v1, e.g. "Host:example.com,www.example.com") rule.
+func traefikRuleHosts(rule string) (hosts []string) {
+	if strings.HasPrefix(rule, "Host:") {
+		for _, host := range strings.Split(strings.TrimPrefix(rule, "Host:"), ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+
+		return hosts
+	}
+
+	for _, match := range reTraefikHost.FindAllStringSubmatch(rule, -1) {
+		for _, host := range strings.Split(match[1], ",") {
+			if host = strings.Trim(strings.TrimSpace(host), "`\"'"); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	return hosts
+}
+
+// sortedKeys returns the keys of m, sorted, so domains are returned in a
+// consistent order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// dockerDomains returns the domains routed to the containers.
+func (f *Finder) dockerDomains(containers []*dockerContainer) []*Domain {
+	entries := dockerEntries(containers)
+	var domains []*Domain
+
+	// webserver is the reverse proxy which routes host to the container.
+	add := func(container *dockerContainer, host, scheme, webserver string) {
+		entry := entries[scheme]
+
+		uri, err := utils.IsDomainURL(scheme+"://"+host, entry.Port)
+		if err != nil {
+			f.Log.Printf("unable to parse docker domain %s (from %s): %s", host, container, err)
+			return
+		}
+
+		domains = append(domains, &Domain{IP: entry.IP, Port: entry.Port, URL: uri, Panel: "docker", Webserver: webserver})
+	}
+
+	for _, container := range containers {
+		f.Log.Printf("found docker container: %s", container)
+
+		if container.Config.Labels["traefik.enable"] != "false" {
+			for _, label := range sortedKeys(container.Config.Labels) {
+				rule := container.Config.Labels[label]
+				var tls bool
+
+				switch {
+				case label == "traefik.frontend.rule":
+					// traefik v1, which we assume is http.
+				case strings.HasPrefix(label, "traefik.http.routers.") && strings.HasSuffix(label, ".rule"):
+					router := strings.TrimSuffix(label, ".rule")
+					tls = container.Config.Labels[router+".tls"] == "true" || container.Config.Labels[router+".tls.certresolver"] != ""
+				default:
+					continue
+				}
+
+				for _, host := range traefikRuleHosts(rule) {
+					if tls {
+						add(container, host, "https", "traefik")
+					} else {
+						add(container, host, "http", "traefik")
+					}
+				}
+			}
+		}
+
+		// nginx-proxy, with optional https via acme-companion.
+		secure := make(map[string]bool)
+		for _, host := range strings.Split(container.env("LETSENCRYPT_HOST"), ",") {
+			secure[strings.TrimSpace(host)] = true
+		}
+
+		for _, host := range strings.Split(container.env("VIRTUAL_HOST"), ",") {
+			if host = strings.TrimSpace(host); host == "" || strings.HasPrefix(host, "~") {
+				continue
+			}
+
+			add(container, host, "http", "nginx-proxy")
+			if secure[host] {
+				add(container, host, "https", "nginx-proxy")
+			}
+		}
+	}
+
+	return domains
+}
+
+// dockerSource reads domains from the labels/environment of running Docker
+// containers, via the Docker Engine API.
+type dockerSource struct{}
+
+func (dockerSource) Name() string        { return "docker" }
+func (dockerSource) Description() string { return "Docker (Traefik, or nginx-proxy VIRTUAL_HOST)" }
+
+func (dockerSource) Detect(f *Finder) bool {
+	if f.Root != "" {
+		// we can't query the api of a snapshot.
+		return false
+	}
+
+	if f.listening("docker-proxy", "traefik") != nil {
+		return true
+	}
+
+	// without the userland proxy, published ports don't have a process
+	// listening on them, so ask the api (if docker is installed at all).
+	info, err := os.Stat(f.dockerSocketPath())
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+
+	return dockerPublished(f.dockerSocketPath())
+}
+
+func (dockerSource) Domains(f *Finder) ([]*Domain, error) {
+	return f.ReadDockerContainers()
+}
@@ -0,0 +1,143 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lrstanley/marill/procfinder"
+)
+
+// newDockerAPI starts a stand-in Docker Engine API on a unix socket, serving
+// the fixtures within fixtures (e.g. testdata/docker).
+func newDockerAPI(t *testing.T, fixtures string) (socket string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "marill-docker")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+
+	socket = filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Skipf("unable to listen on unix socket: %s", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file := fixtures + "/containers.json"
+		if r.URL.Path != "/containers/json" {
+			file = fixtures + strings.TrimSuffix(r.URL.Path, "/json") + ".json"
+		}
+
+		http.ServeFile(w, r, file)
+	}))
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Start()
+
+	return socket, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReadDockerContainers(t *testing.T) {
+	socket, cleanup := newDockerAPI(t, "testdata/docker")
+	defer cleanup()
+
+	f := &Finder{DockerSocket: socket, Log: log.New(ioutil.Discard, "", 0)}
+	domains, err := f.ReadDockerContainers()
+	if err != nil {
+		t.Fatalf("ReadDockerContainers() returned error: %s", err)
+	}
+
+	var out []string
+	for _, dom := range domains {
+		out = append(out, dom.URL.String()+" "+dom.IP+" "+dom.Webserver+" "+dom.Panel)
+	}
+
+	want := []string{
+		"https://traefik.example.com 10.0.0.5 traefik docker",
+		"http://blog.example.com:8000 127.0.0.1 traefik docker",
+		"https://blog.example.com 10.0.0.5 traefik docker",
+		"https://www.blog.example.com 10.0.0.5 traefik docker",
+		"http://shop.example.com:8000 127.0.0.1 nginx-proxy docker",
+		"https://shop.example.com 10.0.0.5 nginx-proxy docker",
+		"http://www.shop.example.com:8000 127.0.0.1 nginx-proxy docker",
+		"http://legacy.example.com:8000 127.0.0.1 traefik docker",
+		"http://old.example.com:8000 127.0.0.1 traefik docker",
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("ReadDockerContainers() == %q, wanted %q", out, want)
+	}
+
+	f = &Finder{DockerSocket: socket + ".missing", Log: log.New(ioutil.Discard, "", 0)}
+	if _, err := f.ReadDockerContainers(); err == nil || err.(Err).GetCode() != ErrDockerFetch {
+		t.Fatalf("ReadDockerContainers() == %v, wanted code %d", err, ErrDockerFetch)
+	}
+
+	return
+}
+
+func TestDockerDetect(t *testing.T) {
+	published, cleanup := newDockerAPI(t, "testdata/docker")
+	defer cleanup()
+	unpublished, cleanup := newDockerAPI(t, "testdata/docker-unpublished")
+	defer cleanup()
+
+	cases := []struct {
+		name      string
+		listening []*procfinder.Process
+		socket    string
+		want      bool
+	}{
+		{name: "docker-proxy", listening: []*procfinder.Process{{Name: "docker-proxy", Port: 8000}}, socket: published + ".missing", want: true},
+		{name: "published", socket: published, want: true},
+		// docker is installed, but isn't serving any sites.
+		{name: "unpublished", socket: unpublished, want: false},
+		{name: "missing", socket: published + ".missing", want: false},
+	}
+
+	for _, c := range cases {
+		f := &Finder{Listening: c.listening, DockerSocket: c.socket, Log: log.New(ioutil.Discard, "", 0)}
+
+		if detected := (dockerSource{}).Detect(f); detected != c.want {
+			t.Fatalf("Detect(%s) == %t, wanted %t", c.name, detected, c.want)
+		}
+	}
+
+	return
+}
+
+func TestTraefikRuleHosts(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"Host(`example.com`)", []string{"example.com"}},
+		{"Host(`example.com`, `www.example.com`) && PathPrefix(`/api`)", []string{"example.com", "www.example.com"}},
+		{"Host(`a.example.com`) || Host(`b.example.com`)", []string{"a.example.com", "b.example.com"}},
+		{"Host:example.com, www.example.com", []string{"example.com", "www.example.com"}},
+		{"PathPrefix(`/`)", nil},
+	}
+
+	for _, c := range cases {
+		if out := traefikRuleHosts(c.in); !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("traefikRuleHosts(%q) == %q, wanted %q", c.in, out, c.want)
+		}
+	}
+
+	return
+}
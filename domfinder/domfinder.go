@@ -8,10 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/url"
-	"os/exec"
 	"strings"
-	"time"
 
 	"github.com/lrstanley/marill/procfinder"
 	"github.com/lrstanley/marill/utils"
@@ -20,25 +19,109 @@ import (
 // webservers represents the list of nice-name processes that we should be checking
 // configurations for.
 var webservers = map[string]bool{
-	"cpsrvd":  true,
-	"httpd":   true,
-	"apache":  true,
-	"lshttpd": true,
-	"nginx":   true,
+	"cpsrvd":        true,
+	"directadmin":   true,
+	"sw-cp-serverd": true, // Plesk
+	"httpd":         true,
+	"apache":        true,
+	"lshttpd":       true,
+	"openlitespeed": true,
+	"nginx":         true,
 }
 
+// localIP is the address used to reach vhosts which are bound to all
+// interfaces (e.g. "*:80").
+const localIP = "127.0.0.1"
+
 // Domain represents a domain we should be checking, including the necessary data
 // to fetch it, with the included host/port proxiable op, and public ip
 type Domain struct {
-	IP   string
-	Port string
-	URL  *url.URL
+	IP     string
+	Port   string
+	URL    *url.URL
+	Source string   // name of the DomainSource the domain was found by
+	Tags   []string // user supplied tags (e.g. from a domains file)
+	// Type, User and DocRoot are the control panel domain type (e.g.
+	// "addon", see CpanelMain, etc), the account which owns the domain, and
+	// its document root, when known.
+	Type    string
+	User    string
+	DocRoot string
+	// ConfigFile and ConfigLine are where the domain is configured (e.g. the
+	// Apache VirtualHost, or nginx server block), when known.
+	ConfigFile string
+	ConfigLine int
+	Panel      string // control panel managing the domain (e.g. "cpanel"), if any
+	Webserver  string // webserver the domain was configured within (e.g. "nginx"), if known
+	// Front and Back are the reverse proxy (e.g. Varnish) the domain is
+	// requested through, and the origin webserver behind it. These are nil
+	// if the domain is served directly by the webserver.
+	Front *Hop
+	Back  *Hop
 }
 
 func (d *Domain) String() string {
 	return fmt.Sprintf("<[%s]::%s:%s>", d.URL.String(), d.IP, d.Port)
 }
 
+// MetaKeys are the keys returned by Domain.Meta, which can also be used
+// within DomainFilter globs (e.g. "user=bob").
+var MetaKeys = [...]string{"source", "type", "user", "docroot", "config", "panel", "webserver"}
+
+// Meta returns the (non-empty) metadata of the domain, e.g. the owning user,
+// document root, and config file (as "file:line"). See MetaKeys.
+func (d *Domain) Meta() map[string]string {
+	meta := map[string]string{
+		"source":    d.Source,
+		"type":      d.Type,
+		"user":      d.User,
+		"docroot":   d.DocRoot,
+		"config":    d.ConfigFile,
+		"panel":     d.Panel,
+		"webserver": d.Webserver,
+	}
+
+	if d.ConfigFile != "" && d.ConfigLine > 0 {
+		meta["config"] = fmt.Sprintf("%s:%d", d.ConfigFile, d.ConfigLine)
+	}
+
+	for key, value := range meta {
+		if value == "" {
+			delete(meta, key)
+		}
+	}
+
+	return meta
+}
+
+// metaGlob splits a "key=glob" DomainFilter entry, where key is one of
+// MetaKeys. ok is false if the entry is a plain url/host glob.
+func metaGlob(match string) (key, glob string, ok bool) {
+	i := strings.Index(match, "=")
+	if i < 1 {
+		return "", "", false
+	}
+
+	for _, k := range MetaKeys {
+		if match[:i] == k {
+			return k, match[i+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+// matchGlob returns true if the domain matches the DomainFilter glob, which
+// is either matched against the url/host, or a "key=glob" metadata entry.
+func (d *Domain) matchGlob(match string) bool {
+	if key, glob, ok := metaGlob(match); ok {
+		value, has := d.Meta()[key]
+		return has && utils.Glob(value, glob)
+	}
+
+	return utils.Glob(d.URL.String(), match) || utils.Glob(d.URL.Host, match)
+}
+
 // Finder represents the entire domain crawl process to find domains that the server
 // is actually hosting.
 type Finder struct {
@@ -51,202 +134,447 @@ type Finder struct {
 	Domains []*Domain
 	// Log is a logger which we should dump debugging info to.
 	Log *log.Logger
+	// ApacheConfig forces Apache based servers to have their configuration
+	// files parsed directly, rather than relying on "httpd -S".
+	ApacheConfig bool
+	// Source is a comma separated list of domain sources (see Sources()) to
+	// use, rather than detecting which sources apply to this server.
+	Source string
+	// UsedSources is the list of sources which domains were successfully
+	// pulled from, during GetDomains.
+	UsedSources []string
+	// Root is the filesystem root which all files (/proc, configuration,
+	// control panel data, etc) are read from, e.g. a captured snapshot of a
+	// server. Webserver binaries are not executed when this is set.
+	Root string
+	// Frontends are the reverse proxies (e.g. Varnish, HAProxy) listening on
+	// the public ports, in front of the webserver.
+	Frontends []*procfinder.Process
+	// Listening are all processes with a listening socket, including those
+	// which aren't webservers (e.g. docker-proxy, for published Docker
+	// container ports), for sources to detect themselves with.
+	Listening []*procfinder.Process
+	// DockerSocket is the path to the Docker Engine API socket, used by the
+	// docker domain source. Defaults to /var/run/docker.sock.
+	DockerSocket string
 }
 
-// DomainFilter filters Finder.Domains based on query input
+// DomainFilter filters Finder.Domains based on query input. All lists are
+// pipe separated. Globs are matched against the url/host, or the domain
+// metadata when in the form of "key=glob" (e.g. "user=bob", see MetaKeys).
+// IPs may be single addresses, or CIDR ranges (e.g. "10.0.3.0/24").
 type DomainFilter struct {
 	IgnoreHTTP  bool   // ignore ^http urls
 	IgnoreHTTPS bool   // ignore ^https urls
 	IgnoreMatch string // ignore urls matching glob
 	MatchOnly   string // ignore urls not matching glob
+	IgnoreIP    string // ignore domains with an ip within the list
+	MatchIP     string // ignore domains without an ip within the list
+	IgnorePort  string // ignore domains with a port within the list
+	MatchPort   string // ignore domains without a port within the list
 }
 
-// Filter allows end users to filter out domains from the automated domain search
-// functionality
-func (f *Finder) Filter(cnf DomainFilter) {
-	new := []*Domain{}
-
-	blacklist := strings.Split(cnf.IgnoreMatch, "|")
-	whitelist := strings.Split(cnf.MatchOnly, "|")
-	var matches bool
+// Validate ensures the ip/CIDR and port lists within the filter are valid.
+func (cnf DomainFilter) Validate() error {
+	for _, list := range []string{cnf.IgnoreIP, cnf.MatchIP} {
+		for _, item := range splitFilter(list) {
+			if strings.Contains(item, "/") {
+				if _, _, err := net.ParseCIDR(item); err != nil {
+					return &NewErr{Code: ErrInvalidFilter, value: item, deepErr: err}
+				}
+			} else if !utils.IsIP(item) {
+				return &NewErr{Code: ErrInvalidFilter, value: item, deepErr: errors.New("not an ip or CIDR range")}
+			}
+		}
+	}
 
-	for i := range f.Domains {
-		matches = false
-		if cnf.IgnoreHTTP && f.Domains[i].URL.Scheme == "http" {
-			continue
+	for _, list := range []string{cnf.IgnorePort, cnf.MatchPort} {
+		for _, item := range splitFilter(list) {
+			if !isPort(item) {
+				return &NewErr{Code: ErrInvalidFilter, value: item, deepErr: errors.New("not a port")}
+			}
 		}
-		if cnf.IgnoreHTTPS && f.Domains[i].URL.Scheme == "https" {
-			continue
+	}
+
+	return nil
+}
+
+// splitFilter splits a pipe separated DomainFilter list.
+func splitFilter(list string) (out []string) {
+	for _, item := range strings.Split(list, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
 		}
+	}
 
-		if len(cnf.IgnoreMatch) > 0 {
-			for _, match := range blacklist {
-				if utils.Glob(f.Domains[i].URL.String(), match) || utils.Glob(f.Domains[i].URL.Host, match) {
-					matches = true
-					break
-				}
-			}
-			if matches {
-				continue // skip
-			}
+	return out
+}
+
+// matchIP returns true if ip is the address, or within the CIDR range.
+func matchIP(ip, match string) bool {
+	addr := net.ParseIP(strings.Trim(ip, "[]"))
+	if addr == nil {
+		return false
+	}
+
+	if strings.Contains(match, "/") {
+		_, network, err := net.ParseCIDR(match)
+		return err == nil && network.Contains(addr)
+	}
+
+	return addr.Equal(net.ParseIP(strings.Trim(match, "[]")))
+}
+
+// filterList returns true if the domain should be kept, based on a pipe
+// separated ignore list and match list (either of which may be empty).
+func filterList(ignore, match string, fn func(string) bool) bool {
+	for _, item := range splitFilter(ignore) {
+		if fn(item) {
+			return false
 		}
+	}
 
-		matches = false
+	if match == "" {
+		return true
+	}
 
-		if len(cnf.MatchOnly) > 0 {
-			for _, match := range whitelist {
-				if utils.Glob(f.Domains[i].URL.String(), match) || utils.Glob(f.Domains[i].URL.Host, match) {
-					matches = true
-					break
-				}
-			}
-			if !matches {
-				continue // skip
-			}
+	for _, item := range splitFilter(match) {
+		if fn(item) {
+			return true
 		}
+	}
+
+	return false
+}
 
-		new = append(new, f.Domains[i])
+// Keep returns true if the domain passes the filter.
+func (cnf DomainFilter) Keep(dom *Domain) bool {
+	if cnf.IgnoreHTTP && dom.URL.Scheme == "http" {
+		return false
 	}
 
-	f.Domains = new
+	if cnf.IgnoreHTTPS && dom.URL.Scheme == "https" {
+		return false
+	}
+
+	return filterList(cnf.IgnoreMatch, cnf.MatchOnly, dom.matchGlob) &&
+		filterList(cnf.IgnoreIP, cnf.MatchIP, func(match string) bool { return matchIP(dom.IP, match) }) &&
+		filterList(cnf.IgnorePort, cnf.MatchPort, func(match string) bool { return dom.Port == match })
+}
+
+// FilterDomains returns the domains which pass the filter. This applies to
+// domains from any source, including manually supplied domains.
+func FilterDomains(domains []*Domain, cnf DomainFilter) []*Domain {
+	new := []*Domain{}
+
+	for _, dom := range domains {
+		if cnf.Keep(dom) {
+			new = append(new, dom)
+		}
+	}
+
+	return new
+}
+
+// Filter allows end users to filter out domains from the automated domain search
+// functionality
+func (f *Finder) Filter(cnf DomainFilter) {
+	f.Domains = FilterDomains(f.Domains, cnf)
 }
 
 // GetWebservers pulls only the web server processes from the process list on the
-// server.
+// server. Webservers may be listening on any port.
 func (f *Finder) GetWebservers() (err error) {
-	tmp, err := procfinder.GetProcs()
+	tmp, err := procfinder.GetProcs(f.Root)
 
 	if err != nil {
 		return err
 	}
 
+	var unsupported *procfinder.Process
 	for i := range tmp {
+		// ignore established connections, we only want the sockets the
+		// webservers are accepting connections on.
+		if !tmp[i].Listening {
+			continue
+		}
+
 		// correction for cPanel proc names, as cPanel dynamically updates these based
 		// on the state of cPanel (idling, SSL, etc)
 		if strings.Contains(tmp[i].Name, "cpsrvd") {
 			tmp[i].Name = "cpsrvd"
 		}
 
+		f.Listening = append(f.Listening, tmp[i])
+
+		if frontends[tmp[i].Name] && isPublicPort(tmp[i].Port) {
+			f.Frontends = append(f.Frontends, tmp[i])
+		}
+
 		if webservers[tmp[i].Name] {
 			f.Procs = append(f.Procs, tmp[i])
+			continue
 		}
-	}
 
-	if len(f.Procs) == 0 {
-		return &NewErr{Code: ErrNoWebservers}
-	}
-
-	// check to see what's listening on ports 80/443, and check to see if we support 'em
-	var stdports *procfinder.Process
-	for i := range f.Procs {
-		if f.Procs[i].Port == 80 || f.Procs[i].Port == 443 {
-			stdports = f.Procs[i]
-			break
+		if unsupported == nil && (tmp[i].Port == 80 || tmp[i].Port == 443) {
+			unsupported = tmp[i]
 		}
 	}
 
-	if stdports == nil {
-		// either the webserver isn't bound, or it's on a port for which we
-		// do not support.
-		return errors.New("found webservers listening, however on non-standard ports")
+	if f.Source != "" {
+		// the sources were supplied by the user, so we don't need a supported
+		// webserver to be listening.
+		return nil
 	}
 
-	if !webservers[stdports.Name] {
-		// assume whatever is listening on port 80/443 is something we don't support
-		return fmt.Errorf("found process PID %s (%s) on port %d, which we don't support", stdports.PID, stdports.Name, stdports.Port)
-	}
+	if len(f.Procs) == 0 {
+		// some sources don't rely on a webserver (e.g. docker).
+		for _, src := range Sources() {
+			if src.Detect(f) {
+				return nil
+			}
+		}
 
-	return nil
-}
+		if unsupported != nil {
+			// assume whatever is listening on port 80/443 is something we don't support
+			return fmt.Errorf("found process PID %s (%s) on port %d, which we don't support", unsupported.PID, unsupported.Name, unsupported.Port)
+		}
 
-// getWebserverMap returns a map of processes based on a key map of the process
-// names. useful to easily know if a process name is within the list
-func (f *Finder) getWebserverMap() (mpl map[string]*procfinder.Process) {
-	mpl = make(map[string]*procfinder.Process)
-	for i := range f.Procs {
-		mpl[f.Procs[i].Name] = f.Procs[i]
+		return &NewErr{Code: ErrNoWebservers}
 	}
 
-	return mpl
+	return nil
 }
 
 // GetMainWebserver returns only one webserver which we should be pulling data
-// from.
+// from. This is the top-most webserver process within the process tree (e.g.
+// the parent process which spawns the workers), regardless of which port it
+// is listening on.
 func (f *Finder) GetMainWebserver() {
+	f.MainProc = nil
+
 	for i := range f.Procs {
-		if f.Procs[i].Port == 80 || f.Procs[i].Port == 443 {
+		var isChild bool
+		for j := range f.Procs {
+			if f.Procs[i].PPID != "" && f.Procs[i].PPID == f.Procs[j].PID && f.Procs[i].Name == f.Procs[j].Name {
+				isChild = true
+				break
+			}
+		}
+
+		if !isChild {
 			f.MainProc = f.Procs[i]
 			return
 		}
 	}
 
-	f.MainProc = nil
-
 	return
 }
 
 // GetDomains represents all of the domains that the current webserver has virtual
-// hosts for.
+// hosts for. All detected sources (or only those within Finder.Source, if
+// supplied) are queried, and their results are combined.
 func (f *Finder) GetDomains() Err {
 	// we want to get just one of the webservers, (or procs), to run our
 	// domain pulling from. commonly httpd spawns multiple child processes
 	// which we don't need to check each one.
-	mpl := f.getWebserverMap()
+	f.GetMainWebserver()
 
-	if f.GetMainWebserver(); f.MainProc == nil {
-		return &NewErr{Code: ErrNoWebservers}
+	sources, err := f.getSources()
+	if err != nil {
+		return err
 	}
 
-	// check to see if there were any cPanel processes within the list
-	if proc, ok := mpl["cpsrvd"]; ok {
-		f.MainProc = proc
+	var domains []*Domain
+	var firstErr Err
+	f.UsedSources = nil
 
-		// assume cPanel based. we can crawl /var/cpanel/ for necessary data.
-		if err := f.ReadCpanelVars(); err != nil {
-			return UpgradeErr(err)
+	for _, src := range sources {
+		f.Log.Printf("fetching domains from source %q (%s)", src.Name(), src.Description())
+
+		found, err := src.Domains(f)
+		if err != nil {
+			e, ok := err.(Err)
+			if !ok {
+				e = UpgradeErr(err)
+			}
+
+			f.Log.Printf("unable to fetch domains from source %q: %s", src.Name(), e)
+			if firstErr == nil {
+				firstErr = e
+			}
+			continue
 		}
 
-		return nil
+		f.Log.Printf("found %d domains from source %q", len(found), src.Name())
+		f.UsedSources = append(f.UsedSources, src.Name())
+
+		for _, dom := range found {
+			if dom.Source == "" {
+				dom.Source = src.Name()
+			}
+		}
+
+		domains = append(domains, found...)
 	}
 
-	if f.MainProc.Name == "httpd" || f.MainProc.Name == "apache" || f.MainProc.Name == "lshttpd" {
-		// assume apache based. should be able to use "-S" switch:
-		// docs: http://httpd.apache.org/docs/current/vhosts/#directives
+	if len(f.UsedSources) == 0 {
+		return firstErr
+	}
 
-		var output []byte
-		var err error
-		done := make(chan bool, 1)
-		cmd := exec.Command(f.MainProc.Exe, "-S")
+	f.applyFrontends(domains)
+	stripDups(&domains)
+	f.Domains = domains
 
-		go func() {
-			output, err = cmd.Output()
-			done <- true
-		}()
+	return nil
+}
 
-		// timeout if we don't hear back from httpd fast enough.
-		select {
-		case <-time.After(10 * time.Second):
-			_ = cmd.Process.Kill()
-			return &NewErr{Code: ErrApacheFetchVhosts, value: "httpd timed out during execution"}
-		case <-done:
+// getSources returns the sources which should be queried for domains, either
+// the ones forced via Finder.Source, or all which are detected.
+func (f *Finder) getSources() ([]DomainSource, Err) {
+	var sources []DomainSource
+
+	if f.Source != "" {
+		for _, name := range strings.Split(f.Source, ",") {
+			src := GetSource(strings.TrimSpace(name))
+			if src == nil {
+				return nil, &NewErr{Code: ErrUnknownSource, value: name}
+			}
+
+			sources = append(sources, src)
 		}
 
-		out := string(output)
+		return sources, nil
+	}
 
-		if err != nil {
-			return &NewErr{Code: ErrApacheFetchVhosts, value: err.Error()}
+	for _, src := range Sources() {
+		if src.Detect(f) {
+			sources = append(sources, src)
+		}
+	}
+
+	if len(sources) == 0 {
+		if f.MainProc == nil {
+			return nil, &NewErr{Code: ErrNoWebservers}
+		}
+
+		return nil, &NewErr{Code: ErrNotImplemented, value: f.MainProc.Name}
+	}
+
+	return sources, nil
+}
+
+// readApacheVhosts pulls vhost entries from the "-S" switch of Apache.
+// docs: http://httpd.apache.org/docs/current/vhosts/#directives
+func (f *Finder) readApacheVhosts(exe string) ([]*Domain, Err) {
+	out, err := execOutput(exe, "-S")
+	if err == errExecTimeout {
+		return nil, &NewErr{Code: ErrApacheFetchVhosts, value: "httpd timed out during execution"}
+	}
+
+	if err != nil {
+		return nil, &NewErr{Code: ErrApacheFetchVhosts, value: err.Error()}
+	}
+
+	if !strings.Contains(out, "VirtualHost configuration") {
+		return nil, &NewErr{Code: ErrApacheInvalidVhosts, value: "binary: " + exe}
+	}
+
+	domains, err := f.ReadApacheVhosts(out)
+	if err != nil {
+		if e, ok := err.(*NewErr); ok {
+			return nil, e
 		}
 
-		if !strings.Contains(out, "VirtualHost configuration") {
-			return &NewErr{Code: ErrApacheInvalidVhosts, value: "binary: " + f.MainProc.Exe}
+		return nil, UpgradeErr(err)
+	}
+
+	return domains, nil
+}
+
+// readApacheConfig locates and parses the Apache configuration files.
+func (f *Finder) readApacheConfig(exe string) ([]*Domain, Err) {
+	root, conf := apacheConfigPath(f.Root, exe)
+	f.Log.Printf("reading apache config from %s (server root: %q)", conf, root)
+
+	domains, err := f.ReadApacheConfig(root, conf)
+	if err != nil {
+		if e, ok := err.(*NewErr); ok {
+			return nil, e
 		}
 
-		if err := f.ReadApacheVhosts(out); err != nil {
-			return UpgradeErr(err)
+		return nil, UpgradeErr(err)
+	}
+
+	return domains, nil
+}
+
+// readLitespeedConfig parses the OpenLiteSpeed configuration files.
+func (f *Finder) readLitespeedConfig(root string) ([]*Domain, Err) {
+	f.Log.Printf("reading litespeed config from %s", root)
+
+	domains, err := f.ReadLitespeedConfig(root)
+	if err != nil {
+		if e, ok := err.(*NewErr); ok {
+			return nil, e
 		}
 
-		return nil
+		return nil, UpgradeErr(err)
+	}
+
+	return domains, nil
+}
+
+// readNginxConfig parses the nginx configuration files from disk, for when
+// "nginx -T" isn't available.
+func (f *Finder) readNginxConfig() ([]*Domain, Err) {
+	out, err := nginxDumpFromDisk(f.Root)
+	if err != nil {
+		if e, ok := err.(*NewErr); ok {
+			return nil, e
+		}
+
+		return nil, UpgradeErr(err)
+	}
+
+	domains, err := f.ReadNginxVhosts(out)
+	if err != nil {
+		if e, ok := err.(*NewErr); ok {
+			return nil, e
+		}
+
+		return nil, UpgradeErr(err)
+	}
+
+	return domains, nil
+}
+
+// readNginxVhosts pulls the server blocks from the "-T" switch of nginx, which
+// tests the configuration, and dumps it (including all included files) to
+// stdout. available since nginx 1.9.2.
+// docs: http://nginx.org/en/docs/switches.html
+func (f *Finder) readNginxVhosts(exe string) ([]*Domain, Err) {
+	out, err := execOutput(exe, "-T")
+	if err == errExecTimeout {
+		return nil, &NewErr{Code: ErrNginxFetchVhosts, value: "nginx timed out during execution"}
+	}
+
+	if err != nil {
+		return nil, &NewErr{Code: ErrNginxFetchVhosts, value: err.Error()}
+	}
+
+	if !strings.Contains(out, "# configuration file ") {
+		return nil, &NewErr{Code: ErrNginxInvalidVhosts, value: "binary: " + exe}
+	}
+
+	domains, err := f.ReadNginxVhosts(out)
+	if err != nil {
+		if e, ok := err.(*NewErr); ok {
+			return nil, e
+		}
+
+		return nil, UpgradeErr(err)
 	}
 
-	return &NewErr{Code: ErrNotImplemented, value: f.MainProc.Name}
+	return domains, nil
 }
@@ -5,9 +5,11 @@
 package domfinder
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/lrstanley/marill/procfinder"
 	"github.com/lrstanley/marill/utils"
 )
 
@@ -71,5 +73,142 @@ func TestFilter(t *testing.T) {
 		{IP: "1.2.3.4", Port: "443", URL: utils.MustURL("domain.com", "443")},
 	}, DomainFilter{IgnoreMatch: "https://*"}, 1)
 
+	// should match bob's domains only
+	run([]*Domain{
+		{IP: "1.2.3.4", Port: "80", URL: utils.MustURL("domain.com", "80"), User: "bob"},
+		{IP: "1.2.3.4", Port: "80", URL: utils.MustURL("other.com", "80"), User: "alice"},
+		{IP: "1.2.3.4", Port: "80", URL: utils.MustURL("none.com", "80")},
+	}, DomainFilter{MatchOnly: "user=bob"}, 1)
+
+	// should ignore those from a config file, and the addon domain
+	run([]*Domain{
+		{IP: "1.2.3.4", Port: "80", URL: utils.MustURL("domain.com", "80"), ConfigFile: "/etc/nginx/conf.d/domain.conf", ConfigLine: 3},
+		{IP: "1.2.3.4", Port: "80", URL: utils.MustURL("other.com", "80"), Type: "addon"},
+		{IP: "1.2.3.4", Port: "80", URL: utils.MustURL("none.com", "80")},
+	}, DomainFilter{IgnoreMatch: "config=/etc/nginx/*|type=addon"}, 1)
+
+	// should match those within the CIDR range, including IPv6
+	run([]*Domain{
+		{IP: "10.0.3.5", Port: "80", URL: utils.MustURL("domain.com", "80")},
+		{IP: "10.0.4.5", Port: "80", URL: utils.MustURL("other.com", "80")},
+		{IP: "2001:db8::5", Port: "80", URL: utils.MustURL("v6.com", "80")},
+		{Port: "80", URL: utils.MustURL("noip.com", "80")},
+	}, DomainFilter{MatchIP: "10.0.3.0/24|2001:db8::/32"}, 2)
+
+	// should ignore the single ip
+	run([]*Domain{
+		{IP: "10.0.3.5", Port: "80", URL: utils.MustURL("domain.com", "80")},
+		{IP: "10.0.3.6", Port: "80", URL: utils.MustURL("other.com", "80")},
+	}, DomainFilter{IgnoreIP: "10.0.3.5"}, 1)
+
+	// should match only port 8443, ignoring those on 10.0.3.5
+	run([]*Domain{
+		{IP: "10.0.3.5", Port: "8443", URL: utils.MustURL("https://domain.com", "8443")},
+		{IP: "10.0.3.6", Port: "8443", URL: utils.MustURL("https://other.com", "8443")},
+		{IP: "10.0.3.6", Port: "443", URL: utils.MustURL("https://other.com", "443")},
+	}, DomainFilter{MatchPort: "8443", IgnoreIP: "10.0.3.5"}, 1)
+
+	// should ignore ports 80 and 8080
+	run([]*Domain{
+		{IP: "10.0.3.5", Port: "80", URL: utils.MustURL("domain.com", "80")},
+		{IP: "10.0.3.5", Port: "8080", URL: utils.MustURL("domain.com", "8080")},
+		{IP: "10.0.3.5", Port: "443", URL: utils.MustURL("https://domain.com", "443")},
+	}, DomainFilter{IgnorePort: "80|8080"}, 1)
+
+	// unknown keys are plain url globs
+	run([]*Domain{
+		{IP: "1.2.3.4", Port: "80", URL: utils.MustURL("http://domain.com/?user=bob", "80"), User: "alice"},
+	}, DomainFilter{MatchOnly: "*?user=bob"}, 1)
+
+	return
+}
+
+func TestDomainFilterValidate(t *testing.T) {
+	cases := []struct {
+		cnf   DomainFilter
+		valid bool
+	}{
+		{DomainFilter{}, true},
+		{DomainFilter{MatchIP: "10.0.3.0/24|1.2.3.4|2001:db8::/32|[::1]", IgnorePort: "80|8443"}, true},
+		{DomainFilter{MatchIP: "10.0.3.0/33"}, false},
+		{DomainFilter{IgnoreIP: "example.com"}, false},
+		{DomainFilter{MatchPort: "http"}, false},
+		{DomainFilter{IgnorePort: "99999"}, false},
+	}
+
+	for _, c := range cases {
+		err := c.cnf.Validate()
+		if (err == nil) != c.valid {
+			t.Fatalf("Validate(%#v) == %v, wanted valid: %t", c.cnf, err, c.valid)
+		}
+
+		if err != nil && err.(Err).GetCode() != ErrInvalidFilter {
+			t.Fatalf("Validate(%#v) returned code %d, wanted %d", c.cnf, err.(Err).GetCode(), ErrInvalidFilter)
+		}
+	}
+
+	return
+}
+
+func TestDomainMeta(t *testing.T) {
+	cases := []struct {
+		dom  *Domain
+		want map[string]string
+	}{
+		{&Domain{}, map[string]string{}},
+		{&Domain{Source: "nginx", ConfigFile: "/etc/nginx/nginx.conf", ConfigLine: 42, DocRoot: "/var/www", Webserver: "nginx"}, map[string]string{
+			"source": "nginx", "config": "/etc/nginx/nginx.conf:42", "docroot": "/var/www", "webserver": "nginx",
+		}},
+		{&Domain{Source: "litespeed", ConfigFile: "/usr/local/lsws/conf/vhosts/a/vhconf.conf"}, map[string]string{
+			"source": "litespeed", "config": "/usr/local/lsws/conf/vhosts/a/vhconf.conf",
+		}},
+		{&Domain{Source: "cpanel", Type: "addon", User: "bob", Panel: "cpanel"}, map[string]string{
+			"source": "cpanel", "type": "addon", "user": "bob", "panel": "cpanel",
+		}},
+	}
+
+	for _, c := range cases {
+		if out := c.dom.Meta(); !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("Meta(%#v) == %v, wanted %v", c.dom, out, c.want)
+		}
+	}
+
+	return
+}
+
+func TestGetMainWebserver(t *testing.T) {
+	cases := []struct {
+		procs []*procfinder.Process
+		want  string // pid of the main process; "" if none
+	}{
+		{procs: nil, want: ""},
+		{procs: []*procfinder.Process{
+			{PID: "201", PPID: "200", Name: "httpd", Port: 8080},
+			{PID: "200", PPID: "1", Name: "httpd", Port: 8080},
+		}, want: "200"},
+		{procs: []*procfinder.Process{
+			{PID: "301", PPID: "300", Name: "nginx", Port: 8443},
+			{PID: "302", PPID: "300", Name: "nginx", Port: 8443},
+		}, want: "301"},
+		{procs: []*procfinder.Process{
+			{PID: "400", PPID: "1", Name: "nginx", Port: 80},
+			{PID: "500", PPID: "1", Name: "httpd", Port: 8080},
+		}, want: "400"},
+	}
+
+	for _, c := range cases {
+		f := &Finder{Procs: c.procs}
+		f.GetMainWebserver()
+
+		var pid string
+		if f.MainProc != nil {
+			pid = f.MainProc.PID
+		}
+
+		if pid != c.want {
+			t.Fatalf("GetMainWebserver() == %q, wanted %q", pid, c.want)
+		}
+	}
+
 	return
 }
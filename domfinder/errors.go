@@ -59,8 +59,26 @@ const (
 	ErrApacheInvalidVhosts
 	ErrApacheParseVhosts
 	ErrApacheNoEntries
+	ErrApacheReadConfig
+	ErrApacheParseConfig
+	ErrNginxFetchVhosts
+	ErrNginxInvalidVhosts
+	ErrNginxParseVhosts
+	ErrNginxNoEntries
+	ErrNginxReadConfig
+	ErrLitespeedReadConfig
+	ErrLitespeedParseConfig
+	ErrLitespeedNoEntries
+	ErrCpanelReadUserdata
+	ErrCpanelNoEntries
+	ErrDockerFetch
+	ErrDockerNoEntries
+	ErrDomainsFileRead
+	ErrDomainsFileParse
+	ErrUnknownSource
 	ErrNotImplemented
 	ErrInvalidURL
+	ErrInvalidFilter
 )
 
 // errMsg contains a map of error name id keys and error/deep error pairs
@@ -68,10 +86,39 @@ var errMsg = map[int]string{
 	ErrUpgradedError:  "not a real error",
 	ErrNoWebservers:   "did not find any webservers running",
 	ErrNotImplemented: "the webserver %s is not implemented at this time",
+	ErrUnknownSource:  "unknown domain source %q",
+	ErrInvalidURL:     "invalid domain %q: %s",
+	ErrInvalidFilter:  "invalid domain filter %q: %s",
+
+	// Domains files
+	ErrDomainsFileRead:  "unable to read domains file %s: %s",
+	ErrDomainsFileParse: "unable to parse domains file %s: %s",
 
 	// Apache specific
 	ErrApacheFetchVhosts:   "unable to obtain vhost data from apache: %s",
 	ErrApacheInvalidVhosts: "apache didn't return valid vhost entries when checking %s",
 	ErrApacheParseVhosts:   "unable to parse Apache vhost: %s",
 	ErrApacheNoEntries:     "no Apache vhost entries found",
+	ErrApacheReadConfig:    "unable to read Apache config %s: %s",
+	ErrApacheParseConfig:   "unable to parse Apache config: %s",
+
+	// Nginx specific
+	ErrNginxFetchVhosts:   "unable to obtain vhost data from nginx: %s",
+	ErrNginxInvalidVhosts: "nginx didn't return a valid configuration dump when checking %s",
+	ErrNginxParseVhosts:   "unable to parse nginx configuration: %s",
+	ErrNginxNoEntries:     "no nginx server blocks found",
+	ErrNginxReadConfig:    "unable to read nginx config %s: %s",
+
+	// LiteSpeed specific
+	ErrLitespeedReadConfig:  "unable to read LiteSpeed config %s: %s",
+	ErrLitespeedParseConfig: "unable to parse LiteSpeed config: %s",
+	ErrLitespeedNoEntries:   "no LiteSpeed vhost entries found",
+
+	// cPanel specific
+	ErrCpanelReadUserdata: "unable to read cPanel userdata domains %s: %s",
+	ErrCpanelNoEntries:    "no cPanel domains found",
+
+	// Docker specific
+	ErrDockerFetch:     "unable to query the Docker API at %s: %s",
+	ErrDockerNoEntries: "no routed Docker containers found",
 }
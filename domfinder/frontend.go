@@ -0,0 +1,123 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/lrstanley/marill/procfinder"
+	"github.com/lrstanley/marill/utils"
+)
+
+// frontends represents the list of nice-name processes which are commonly
+// used as reverse proxies in front of the webserver (e.g. Varnish on :80,
+// proxying to Apache on :8080).
+var frontends = map[string]bool{
+	"varnishd": true,
+	"haproxy":  true,
+	"nginx":    true,
+}
+
+// Hop represents a single server a request passes through, e.g. a reverse
+// proxy, or the origin webserver behind it.
+type Hop struct {
+	Name string   // process name (e.g. "varnishd"), or domain source of the origin
+	IP   string   // ip the hop is reachable on
+	Port string   // port the hop is listening on
+	URL  *url.URL // url as it is requested at this hop
+}
+
+func (h *Hop) String() string {
+	return fmt.Sprintf("%s(%s:%s)", h.Name, h.IP, h.Port)
+}
+
+// isPublicPort returns true if port is a standard http/https port, which
+// frontends are expected to be listening on.
+func isPublicPort(port int64) bool {
+	return port == 80 || port == 443
+}
+
+// frontend returns the frontend process which is listening on port, if any.
+func (f *Finder) frontend(port string) *procfinder.Process {
+	for _, proc := range f.Frontends {
+		if strconv.FormatInt(proc.Port, 10) == port {
+			return proc
+		}
+	}
+
+	return nil
+}
+
+// listeningOn returns true if proc, or another process of the same server
+// (e.g. the master or a worker of an nginx instance), is listening on port.
+func (f *Finder) listeningOn(proc *procfinder.Process, port string) bool {
+	for _, other := range f.Listening {
+		if strconv.FormatInt(other.Port, 10) != port {
+			continue
+		}
+
+		if other.PID == proc.PID {
+			return true
+		}
+
+		if other.Name == proc.Name && (other.PPID == proc.PID || other.PID == proc.PPID || (other.PPID != "" && other.PPID == proc.PPID)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyFrontends rewrites domains which are served by a webserver on a
+// non-public port (e.g. Apache on :8080), to be requested through the
+// frontend on the public port instead. Both hops are recorded on the domain.
+func (f *Finder) applyFrontends(domains []*Domain) {
+	if len(f.Frontends) == 0 {
+		return
+	}
+
+	for _, dom := range domains {
+		if dom.Front != nil {
+			continue
+		}
+
+		port, err := strconv.ParseInt(dom.Port, 10, 64)
+		if err != nil || isPublicPort(port) {
+			continue
+		}
+
+		frontPort := "80"
+		if dom.URL.Scheme == "https" {
+			frontPort = "443"
+		}
+
+		proc := f.frontend(frontPort)
+		if proc == nil || f.listeningOn(proc, dom.Port) {
+			// no frontend, or the frontend is the webserver itself (e.g. nginx
+			// with server blocks on multiple ports).
+			continue
+		}
+
+		frontIP := proc.IP
+		if isWildcardIP(frontIP) {
+			frontIP = dom.IP
+		}
+
+		frontURL, err := utils.IsDomainURL(dom.URL.Scheme+"://"+dom.URL.Hostname(), frontPort)
+		if err != nil {
+			f.Log.Printf("unable to rewrite %s through frontend %s: %s", dom, proc.Name, err)
+			continue
+		}
+		frontURL.Path, frontURL.RawQuery = dom.URL.Path, dom.URL.RawQuery
+
+		dom.Back = &Hop{Name: dom.Source, IP: dom.IP, Port: dom.Port, URL: dom.URL}
+		dom.Front = &Hop{Name: proc.Name, IP: frontIP, Port: frontPort, URL: frontURL}
+		dom.IP, dom.Port, dom.URL = frontIP, frontPort, frontURL
+
+		f.Log.Printf("requesting %s through frontend %s (origin: %s)", dom.URL, dom.Front, dom.Back)
+	}
+}
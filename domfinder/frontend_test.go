@@ -0,0 +1,95 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/lrstanley/marill/procfinder"
+	"github.com/lrstanley/marill/utils"
+)
+
+func TestApplyFrontends(t *testing.T) {
+	cases := []struct {
+		front  *procfinder.Process // frontend listening on a public port
+		back   *procfinder.Process // webserver listening on the port of the domain
+		source string              // source the domain was found by
+		host   string
+		port   string
+		want   string // wanted url, through the frontend
+		ip     string // wanted ip, through the frontend
+		origin string // wanted origin url; empty if not proxied
+	}{
+		{
+			&procfinder.Process{PID: "100", Name: "varnishd", IP: "0.0.0.0", Port: 80}, &procfinder.Process{PID: "200", Name: "httpd", Port: 8080},
+			"apache", "example.com", "8080", "http://example.com", "10.0.0.5", "http://example.com:8080",
+		},
+		{
+			&procfinder.Process{PID: "100", Name: "haproxy", IP: "10.0.0.1", Port: 443}, &procfinder.Process{PID: "200", Name: "httpd", Port: 8443},
+			"apache", "example.com", "8443", "https://example.com", "10.0.0.1", "https://example.com:8443",
+		},
+		{
+			&procfinder.Process{PID: "100", Name: "varnishd", IP: "0.0.0.0", Port: 80}, &procfinder.Process{PID: "200", Name: "httpd", Port: 8443},
+			"apache", "example.com", "8443", "https://example.com:8443", "10.0.0.5", "",
+		},
+		{
+			&procfinder.Process{PID: "100", Name: "varnishd", IP: "0.0.0.0", Port: 80}, nil,
+			"apache", "example.com", "80", "http://example.com", "10.0.0.5", "",
+		},
+		// nginx with server blocks on multiple ports, no matter which source
+		// found the domain.
+		{
+			&procfinder.Process{PID: "100", Name: "nginx", IP: "0.0.0.0", Port: 80}, &procfinder.Process{PID: "100", Name: "nginx", Port: 8080},
+			"nginx", "example.com", "8080", "http://example.com:8080", "10.0.0.5", "",
+		},
+		{
+			&procfinder.Process{PID: "101", PPID: "100", Name: "nginx", IP: "0.0.0.0", Port: 80}, &procfinder.Process{PID: "102", PPID: "100", Name: "nginx", Port: 8443},
+			"plesk", "example.com", "8443", "https://example.com:8443", "10.0.0.5", "",
+		},
+		// a separate webserver behind nginx.
+		{
+			&procfinder.Process{PID: "100", Name: "nginx", IP: "0.0.0.0", Port: 80}, &procfinder.Process{PID: "200", Name: "cpsrvd", Port: 81},
+			"cpanel", "example.com", "81", "http://example.com", "10.0.0.5", "http://example.com:81",
+		},
+		{
+			&procfinder.Process{PID: "100", Name: "nginx", IP: "0.0.0.0", Port: 80}, &procfinder.Process{PID: "200", PPID: "1", Name: "nginx", Port: 8080},
+			"nginx", "example.com", "8080", "http://example.com", "10.0.0.5", "http://example.com:8080",
+		},
+	}
+
+	for _, c := range cases {
+		f := &Finder{Frontends: []*procfinder.Process{c.front}, Listening: []*procfinder.Process{c.front}, Log: log.New(ioutil.Discard, "", 0)}
+		if c.back != nil {
+			f.Listening = append(f.Listening, c.back)
+		}
+		dom := &Domain{IP: "10.0.0.5", Port: c.port, URL: utils.MustURL(c.host, c.port), Source: c.source}
+
+		f.applyFrontends([]*Domain{dom})
+
+		if dom.URL.String() != c.want || dom.IP != c.ip {
+			t.Fatalf("applyFrontends(%s:%s via %s) == %s (%s), wanted %s (%s)", c.host, c.port, c.front.Name, dom.URL, dom.IP, c.want, c.ip)
+		}
+
+		if c.origin == "" {
+			if dom.Front != nil || dom.Back != nil {
+				t.Fatalf("applyFrontends(%s:%s via %s) == %s -> %s, wanted no hops", c.host, c.port, c.front.Name, dom.Front, dom.Back)
+			}
+
+			continue
+		}
+
+		if dom.Back == nil || dom.Back.URL.String() != c.origin || dom.Back.Port != c.port {
+			t.Fatalf("applyFrontends(%s:%s via %s) origin == %v, wanted %s", c.host, c.port, c.front.Name, dom.Back, c.origin)
+		}
+
+		if dom.Front == nil || dom.Front.Name != c.front.Name || dom.Front.URL != dom.URL {
+			t.Fatalf("applyFrontends(%s:%s via %s) front == %v, wanted %s", c.host, c.port, c.front.Name, dom.Front, c.front.Name)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,341 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/lrstanley/marill/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// Domains file formats, as supported by ReadDomainsFile.
+const (
+	FormatHosts = "hosts" // /etc/hosts format: "IP DOMAIN [DOMAIN ...]"
+	FormatCSV   = "csv"   // "url,ip,port,tags", with an optional header
+	FormatYAML  = "yaml"  // Kubernetes Ingress/HTTPRoute manifests
+)
+
+// manualSource is the Domain.Source of manually supplied domains.
+const manualSource = "manual"
+
+// reManualHost matches a plain (non-url) domain, which may be
+// internationalized.
+var reManualHost = regexp.MustCompile(`^[\p{L}\p{N}_-]+(?:\.[\p{L}\p{N}_-]+)*\.[\p{L}\p{N}-]{2,63}$`)
+
+// NewManualDomain validates a manually supplied domain or url (e.g. from
+// --domains, or a domains file), along with an optional ip and port. All
+// manually supplied domains should go through this.
+func NewManualDomain(host, ip, port string) (*Domain, error) {
+	if host == "" {
+		return nil, &NewErr{Code: ErrInvalidURL, value: host, deepErr: errors.New("missing domain")}
+	}
+
+	ip = strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+	if ip != "" && !utils.IsIP(ip) {
+		return nil, &NewErr{Code: ErrInvalidURL, value: host, deepErr: fmt.Errorf("invalid ip %q", ip)}
+	}
+
+	if port != "" && !isPort(port) {
+		return nil, &NewErr{Code: ErrInvalidURL, value: host, deepErr: fmt.Errorf("invalid port %q", port)}
+	}
+
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") && !reManualHost.MatchString(host) {
+		return nil, &NewErr{Code: ErrInvalidURL, value: host, deepErr: errors.New("not a valid domain or url")}
+	}
+
+	uri, err := utils.IsDomainURL(host, port)
+	if err != nil {
+		return nil, &NewErr{Code: ErrInvalidURL, value: host, deepErr: err}
+	}
+
+	if port == "" {
+		if port = uri.Port(); port == "" {
+			port = "80"
+			if uri.Scheme == "https" {
+				port = "443"
+			}
+		}
+	}
+
+	return &Domain{IP: ip, Port: port, URL: uri, Source: manualSource}, nil
+}
+
+// domainsFileFormat returns the format of a domains file, based on its
+// extension, falling back to its contents.
+func domainsFileFormat(path, raw string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+
+	if strings.Contains(raw, "apiVersion:") {
+		return FormatYAML
+	}
+
+	for _, line := range strings.Split(raw, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.Contains(line, ",") {
+			return FormatCSV
+		}
+
+		break
+	}
+
+	return FormatHosts
+}
+
+// ReadDomainsFile reads the domains from a file, in /etc/hosts format, CSV
+// ("url,ip,port,tags") or Kubernetes Ingress/HTTPRoute manifests (YAML). The
+// format is based on the extension of the file, or its contents. ingressIP
+// is the ip Kubernetes hosts are requested through (if not supplied, the
+// load balancer ip within the manifest status is used, if any).
+func ReadDomainsFile(path, ingressIP string) ([]*Domain, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &NewErr{Code: ErrDomainsFileRead, value: path, deepErr: err}
+	}
+
+	return ParseDomains(path, string(raw), domainsFileFormat(path, string(raw)), ingressIP)
+}
+
+// ParseDomains parses the domains within raw, in the given format (see
+// ReadDomainsFile). name is used to reference the input in errors.
+func ParseDomains(name, raw, format, ingressIP string) (domains []*Domain, err error) {
+	switch format {
+	case FormatHosts:
+		domains, err = parseHostsDomains(raw)
+	case FormatCSV:
+		domains, err = parseCSVDomains(raw)
+	case FormatYAML:
+		domains, err = parseManifestDomains(raw, ingressIP)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+
+	if err != nil {
+		return nil, &NewErr{Code: ErrDomainsFileParse, value: name, deepErr: err}
+	}
+
+	stripDups(&domains)
+	return domains, nil
+}
+
+// isLocalHostname returns true if the /etc/hosts name isn't something we
+// should scan (e.g. "localhost", or short hostnames).
+func isLocalHostname(name string) bool {
+	return !strings.Contains(name, ".") || strings.HasPrefix(name, "localhost") || strings.HasPrefix(name, "ip6-")
+}
+
+// parseHostsDomains parses /etc/hosts formatted domains.
+func parseHostsDomains(raw string) (domains []*Domain, err error) {
+	for i, line := range strings.Split(raw, "\n") {
+		if n := strings.Index(line, "#"); n > -1 {
+			line = line[:n]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 2 || !utils.IsIP(fields[0]) {
+			return nil, fmt.Errorf("line %d: expected \"IP DOMAIN [DOMAIN ...]\", got %q", i+1, strings.TrimSpace(line))
+		}
+
+		for _, name := range fields[1:] {
+			if isLocalHostname(name) {
+				continue
+			}
+
+			dom, err := NewManualDomain(name, fields[0], "")
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+1, err)
+			}
+
+			domains = append(domains, dom)
+		}
+	}
+
+	return domains, nil
+}
+
+// parseCSVDomains parses "url,ip,port,tags" CSV formatted domains. Only the
+// url is required, and tags are separated by semicolons or spaces.
+func parseCSVDomains(raw string) (domains []*Domain, err error) {
+	r := csv.NewReader(strings.NewReader(raw))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	for num := 1; ; num++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) > 4 {
+			return nil, fmt.Errorf("record %d: expected at most 4 fields (url,ip,port,tags), got %d", num, len(record))
+		}
+
+		for len(record) < 4 {
+			record = append(record, "")
+		}
+
+		if num == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "url") {
+			// header.
+			continue
+		}
+
+		dom, err := NewManualDomain(strings.TrimSpace(record[0]), strings.TrimSpace(record[1]), strings.TrimSpace(record[2]))
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %s", num, err)
+		}
+
+		dom.Tags = strings.FieldsFunc(record[3], func(r rune) bool {
+			return r == ';' || unicode.IsSpace(r)
+		})
+
+		domains = append(domains, dom)
+	}
+
+	return domains, nil
+}
+
+// manifest is a Kubernetes object (or List of objects), with only the fields
+// needed to find the hosts of Ingress and HTTPRoute objects.
+type manifest struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Rules []struct {
+			Host string `yaml:"host"`
+		} `yaml:"rules"` // Ingress
+		TLS []struct {
+			Hosts []string `yaml:"hosts"`
+		} `yaml:"tls"` // Ingress
+		Hostnames []string `yaml:"hostnames"` // HTTPRoute
+	} `yaml:"spec"`
+	Status struct {
+		LoadBalancer struct {
+			Ingress []struct {
+				IP string `yaml:"ip"`
+			} `yaml:"ingress"`
+		} `yaml:"loadBalancer"`
+	} `yaml:"status"`
+	Items []*manifest `yaml:"items"` // List
+}
+
+// manifestKinds are the kinds of objects we read hosts from.
+var manifestKinds = map[string]bool{"List": true, "Ingress": true, "HTTPRoute": true}
+
+// reYAMLDocument matches the separator between documents within a YAML
+// stream.
+var reYAMLDocument = regexp.MustCompile(`(?m)^---[ \t]*(?:#.*)?$`)
+
+// parseManifestDomains parses the hosts within Kubernetes Ingress and
+// HTTPRoute manifests (including those within a List).
+func parseManifestDomains(raw, ingressIP string) (domains []*Domain, err error) {
+	var objects []*manifest
+	for _, doc := range reYAMLDocument.Split(raw, -1) {
+		obj := &manifest{}
+		if err = yaml.Unmarshal([]byte(doc), obj); err != nil {
+			if _, ok := err.(*yaml.TypeError); !ok || manifestKinds[obj.Kind] {
+				return nil, err
+			}
+
+			// other kinds of objects may use the same field names for
+			// something else.
+			continue
+		}
+
+		if obj.Kind == "List" {
+			objects = append(objects, obj.Items...)
+			continue
+		}
+
+		objects = append(objects, obj)
+	}
+
+	for _, obj := range objects {
+		if obj == nil {
+			continue
+		}
+
+		tag := strings.ToLower(obj.Kind) + ":" + obj.Metadata.Name
+		if obj.Metadata.Namespace != "" {
+			tag = strings.ToLower(obj.Kind) + ":" + obj.Metadata.Namespace + "/" + obj.Metadata.Name
+		}
+
+		ip := ingressIP
+		if ip == "" && len(obj.Status.LoadBalancer.Ingress) > 0 {
+			ip = obj.Status.LoadBalancer.Ingress[0].IP
+		}
+
+		var hosts []string
+		secure := make(map[string]bool)
+
+		switch obj.Kind {
+		case "Ingress":
+			for _, rule := range obj.Spec.Rules {
+				hosts = append(hosts, rule.Host)
+			}
+
+			for _, tls := range obj.Spec.TLS {
+				for _, host := range tls.Hosts {
+					secure[host] = true
+				}
+			}
+		case "HTTPRoute":
+			hosts = obj.Spec.Hostnames
+		default:
+			continue
+		}
+
+		for _, host := range hosts {
+			if host == "" || strings.HasPrefix(host, "*") {
+				// rules without a host (or wildcards) match any host.
+				continue
+			}
+
+			schemes := []string{"http"}
+			if secure[host] {
+				schemes = append(schemes, "https")
+			}
+
+			for _, scheme := range schemes {
+				dom, err := NewManualDomain(scheme+"://"+host, ip, "")
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", tag, err)
+				}
+
+				dom.Tags = []string{tag}
+				domains = append(domains, dom)
+			}
+		}
+	}
+
+	return domains, nil
+}
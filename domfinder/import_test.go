@@ -0,0 +1,168 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewManualDomain(t *testing.T) {
+	cases := []struct {
+		host string
+		ip   string
+		port string
+		want string // "url ip port"; empty if an error is expected
+	}{
+		{host: "example.com", want: "http://example.com  80"},
+		{host: "example.com", ip: "1.2.3.4", port: "443", want: "https://example.com 1.2.3.4 443"},
+		{host: "example.com", ip: "[2001:db8::1]", port: "8080", want: "http://example.com:8080 2001:db8::1 8080"},
+		{host: "https://example.com/path", want: "https://example.com/path  443"},
+		{host: "bücher.de", want: "http://xn--bcher-kva.de  80"},
+		{host: "example.com", ip: "1.2.3", port: ""},
+		{host: "example.com", port: "99999"},
+		{host: "localhost"},
+		{host: "exa mple.com"},
+		{host: "*.example.com"},
+		{host: ""},
+	}
+
+	for _, c := range cases {
+		dom, err := NewManualDomain(c.host, c.ip, c.port)
+
+		if c.want == "" {
+			if err == nil {
+				t.Fatalf("NewManualDomain(%q, %q, %q) == %s, wanted error", c.host, c.ip, c.port, dom)
+			}
+
+			if code := err.(Err).GetCode(); code != ErrInvalidURL {
+				t.Fatalf("NewManualDomain(%q, %q, %q) returned code %d, wanted %d", c.host, c.ip, c.port, code, ErrInvalidURL)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("NewManualDomain(%q, %q, %q) returned error: %s", c.host, c.ip, c.port, err)
+		}
+
+		if out := dom.URL.String() + " " + dom.IP + " " + dom.Port; out != c.want {
+			t.Fatalf("NewManualDomain(%q, %q, %q) == %q, wanted %q", c.host, c.ip, c.port, out, c.want)
+		}
+	}
+
+	return
+}
+
+func TestReadDomainsFile(t *testing.T) {
+	cases := []struct {
+		file      string
+		ingressIP string
+		want      []string // "url ip [tags]"
+	}{
+		{file: "testdata/domains/hosts", want: []string{
+			"http://example.com 10.0.0.5 []",
+			"http://www.example.com 10.0.0.5 []",
+			"http://shop.example.com 10.0.0.6 []",
+			"http://v6.example.com 2001:db8::7 []",
+			"http://xn--bcher-kva.de 10.0.0.8 []",
+		}},
+		{file: "testdata/domains/inventory.csv", want: []string{
+			"http://example.com 10.0.0.5 [prod web]",
+			"https://shop.example.com:8443/cart 10.0.0.6 [prod shop]",
+			"http://staging.example.com  []",
+			"http://api.example.com:8080 2001:db8::9 []",
+		}},
+		{file: "testdata/domains/ingress.yaml", want: []string{
+			"http://example.com 203.0.113.10 [ingress:prod/web]",
+			"https://example.com 203.0.113.10 [ingress:prod/web]",
+			"http://www.example.com 203.0.113.10 [ingress:prod/web]",
+			"https://www.example.com 203.0.113.10 [ingress:prod/web]",
+			"http://api.example.com  [httproute:api]",
+			"http://docs.example.com  [httproute:api]",
+		}},
+		{file: "testdata/domains/ingress.yaml", ingressIP: "10.0.0.100", want: []string{
+			"http://example.com 10.0.0.100 [ingress:prod/web]",
+			"https://example.com 10.0.0.100 [ingress:prod/web]",
+			"http://www.example.com 10.0.0.100 [ingress:prod/web]",
+			"https://www.example.com 10.0.0.100 [ingress:prod/web]",
+			"http://api.example.com 10.0.0.100 [httproute:api]",
+			"http://docs.example.com 10.0.0.100 [httproute:api]",
+		}},
+	}
+
+	for _, c := range cases {
+		domains, err := ReadDomainsFile(c.file, c.ingressIP)
+		if err != nil {
+			t.Fatalf("ReadDomainsFile(%q) returned error: %s", c.file, err)
+		}
+
+		var out []string
+		for _, dom := range domains {
+			out = append(out, dom.URL.String()+" "+dom.IP+" ["+strings.Join(dom.Tags, " ")+"]")
+
+			if dom.Source != manualSource {
+				t.Fatalf("ReadDomainsFile(%q) returned source %q, wanted %q", c.file, dom.Source, manualSource)
+			}
+		}
+
+		if !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("ReadDomainsFile(%q) == %q, wanted %q", c.file, out, c.want)
+		}
+	}
+
+	if _, err := ReadDomainsFile("testdata/domains/missing", ""); err == nil || err.(Err).GetCode() != ErrDomainsFileRead {
+		t.Fatalf("ReadDomainsFile(missing) == %v, wanted code %d", err, ErrDomainsFileRead)
+	}
+
+	return
+}
+
+func TestParseDomains(t *testing.T) {
+	cases := []struct {
+		in     string
+		format string
+	}{
+		{"example.com 10.0.0.5", FormatHosts},
+		{"10.0.0.5", FormatHosts},
+		{"10.0.0.5 exa_mple..com", FormatHosts},
+		{"example.com,not-an-ip", FormatCSV},
+		{"example.com,10.0.0.5,80,tag,extra", FormatCSV},
+		{"kind: Ingress\nspec:\n  rules:\n  - host: \"bad host.com\"", FormatYAML},
+		{"kind: Ingress\n  spec: bad", FormatYAML},
+		{"example.com", "xml"},
+	}
+
+	for _, c := range cases {
+		if _, err := ParseDomains("test", c.in, c.format, ""); err == nil || err.(Err).GetCode() != ErrDomainsFileParse {
+			t.Fatalf("ParseDomains(%q, %q) == %v, wanted code %d", c.in, c.format, err, ErrDomainsFileParse)
+		}
+	}
+
+	return
+}
+
+func TestDomainsFileFormat(t *testing.T) {
+	cases := []struct {
+		path string
+		raw  string
+		want string
+	}{
+		{"domains.csv", "", FormatCSV},
+		{"ingress.YML", "", FormatYAML},
+		{"domains", "# inventory\nexample.com,1.2.3.4\n", FormatCSV},
+		{"manifest", "---\napiVersion: v1\nkind: List\n", FormatYAML},
+		{"hosts", "1.2.3.4 example.com\n", FormatHosts},
+	}
+
+	for _, c := range cases {
+		if out := domainsFileFormat(c.path, c.raw); out != c.want {
+			t.Fatalf("domainsFileFormat(%q, %q) == %q, wanted %q", c.path, c.raw, out, c.want)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,468 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+// litespeedRoot is the default OpenLiteSpeed server root, used when it can't
+// be determined from the running binary.
+const litespeedRoot = "/usr/local/lsws"
+
+// lsListener represents an OpenLiteSpeed listener, and the vhosts mapped to it.
+type lsListener struct {
+	Name    string
+	Address string
+	Secure  bool
+	Maps    []*lsMap
+}
+
+func (l *lsListener) String() string {
+	return fmt.Sprintf("<[LiteSpeed listener] name:%q address:%q secure:%t maps:%d>", l.Name, l.Address, l.Secure, len(l.Maps))
+}
+
+// lsMap maps a vhost to a listener, for the given domains.
+type lsMap struct {
+	Vhost   string
+	Domains []string
+}
+
+// lsVhost represents an OpenLiteSpeed virtual host.
+type lsVhost struct {
+	Name       string
+	Root       string
+	ConfigFile string
+	Domains    []string // vhDomain, followed by vhAliases
+}
+
+// lsNode represents a directive (or block) from the plain-text OpenLiteSpeed
+// configuration format.
+type lsNode struct {
+	key      string
+	value    string
+	children []*lsNode
+	line     int
+}
+
+// get returns the value of the first child directive with the given key.
+func (n *lsNode) get(key string) string {
+	for _, child := range n.children {
+		if strings.EqualFold(child.key, key) {
+			return child.value
+		}
+	}
+
+	return ""
+}
+
+// parseLitespeedPlain parses the plain-text OpenLiteSpeed configuration format.
+// docs: https://openlitespeed.org/kb/
+func parseLitespeedPlain(path string) (*lsNode, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &NewErr{Code: ErrLitespeedReadConfig, value: path, deepErr: err}
+	}
+	defer file.Close()
+
+	root := &lsNode{}
+	stack := []*lsNode{root}
+	var heredoc string
+	var lineNum int
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// skip the contents of heredoc values (e.g. rewrite rules).
+		if heredoc != "" {
+			if line == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if line == "}" {
+			if len(stack) == 1 {
+				return nil, &NewErr{Code: ErrLitespeedParseConfig, value: fmt.Sprintf("%s (line %d): unexpected '}'", path, lineNum)}
+			}
+
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		parent := stack[len(stack)-1]
+
+		if strings.HasSuffix(line, "{") {
+			fields := strings.Fields(strings.TrimSuffix(line, "{"))
+			if len(fields) == 0 {
+				return nil, &NewErr{Code: ErrLitespeedParseConfig, value: fmt.Sprintf("%s (line %d): unnamed block", path, lineNum)}
+			}
+
+			node := &lsNode{key: fields[0], value: strings.Join(fields[1:], " "), line: lineNum}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		node := &lsNode{key: fields[0], line: lineNum}
+		if len(fields) == 2 {
+			node.value = strings.TrimSpace(fields[1])
+		}
+
+		if strings.HasPrefix(node.value, "<<<") {
+			heredoc = strings.TrimPrefix(node.value, "<<<")
+			node.value = ""
+		}
+
+		parent.children = append(parent.children, node)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, &NewErr{Code: ErrLitespeedReadConfig, value: path, deepErr: err}
+	}
+
+	if len(stack) != 1 {
+		return nil, &NewErr{Code: ErrLitespeedParseConfig, value: fmt.Sprintf("%s: unexpected end of file, missing '}'", path)}
+	}
+
+	return root, nil
+}
+
+// splitLitespeedList splits comma and/or space separated lists, as used by
+// listener maps and vhAliases.
+func splitLitespeedList(in string) []string {
+	return strings.FieldsFunc(in, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// readLitespeedPlain reads the listeners and vhosts from the plain-text
+// httpd_config.conf format.
+func readLitespeedPlain(path string) (listeners []*lsListener, vhosts []*lsVhost, err error) {
+	conf, err := parseLitespeedPlain(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// templates are mapped to their listeners once all listeners are known,
+	// as they can be defined before them.
+	var templates []*lsNode
+
+	for _, node := range conf.children {
+		switch strings.ToLower(node.key) {
+		case "listener":
+			listener := &lsListener{
+				Name:    node.value,
+				Address: node.get("address"),
+				Secure:  node.get("secure") == "1",
+			}
+
+			for _, child := range node.children {
+				if !strings.EqualFold(child.key, "map") {
+					continue
+				}
+
+				fields := strings.SplitN(child.value, " ", 2)
+				if len(fields) != 2 {
+					continue
+				}
+
+				listener.Maps = append(listener.Maps, &lsMap{Vhost: fields[0], Domains: splitLitespeedList(fields[1])})
+			}
+
+			listeners = append(listeners, listener)
+		case "virtualhost":
+			vhosts = append(vhosts, &lsVhost{
+				Name:       node.value,
+				Root:       node.get("vhRoot"),
+				ConfigFile: node.get("configFile"),
+			})
+		case "vhtemplate":
+			templates = append(templates, node)
+		}
+	}
+
+	for _, node := range templates {
+		// vhosts created from a template are mapped to all listeners of the
+		// template, using their vhDomain (or name if not set).
+		var members []string
+		for _, child := range node.children {
+			if !strings.EqualFold(child.key, "member") {
+				continue
+			}
+
+			member := strings.Fields(child.value)
+			if len(member) == 0 {
+				continue
+			}
+
+			domain := child.get("vhDomain")
+			if domain == "" {
+				domain = member[0]
+			}
+
+			members = append(members, domain)
+			if aliases := child.get("vhAliases"); aliases != "" {
+				members = append(members, splitLitespeedList(aliases)...)
+			}
+		}
+
+		for _, name := range splitLitespeedList(node.get("listeners")) {
+			for _, listener := range listeners {
+				if listener.Name == name {
+					listener.Maps = append(listener.Maps, &lsMap{Vhost: node.value, Domains: members})
+				}
+			}
+		}
+	}
+
+	return listeners, vhosts, nil
+}
+
+// lsXMLConfig represents the (legacy) httpd_config.xml format.
+type lsXMLConfig struct {
+	Listeners []struct {
+		Name    string `xml:"name"`
+		Address string `xml:"address"`
+		Secure  string `xml:"secure"`
+		Maps    []struct {
+			Vhost  string `xml:"vhost"`
+			Domain string `xml:"domain"`
+		} `xml:"vhostMapList>vhostMap"`
+	} `xml:"listenerList>listener"`
+	Vhosts []struct {
+		Name       string `xml:"name"`
+		Root       string `xml:"vhRoot"`
+		ConfigFile string `xml:"configFile"`
+	} `xml:"virtualHostList>virtualHost"`
+}
+
+// lsXMLVhost represents the (legacy) vhconf.xml format.
+type lsXMLVhost struct {
+	Domain  string `xml:"vhDomain"`
+	Aliases string `xml:"vhAliases"`
+}
+
+// readLitespeedXML reads the listeners and vhosts from the legacy
+// httpd_config.xml format.
+func readLitespeedXML(path string) (listeners []*lsListener, vhosts []*lsVhost, err error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, &NewErr{Code: ErrLitespeedReadConfig, value: path, deepErr: err}
+	}
+
+	conf := &lsXMLConfig{}
+	if err = xml.Unmarshal(raw, conf); err != nil {
+		return nil, nil, &NewErr{Code: ErrLitespeedParseConfig, value: path + ": " + err.Error()}
+	}
+
+	for _, item := range conf.Listeners {
+		listener := &lsListener{Name: item.Name, Address: item.Address, Secure: item.Secure == "1"}
+		for _, m := range item.Maps {
+			listener.Maps = append(listener.Maps, &lsMap{Vhost: m.Vhost, Domains: splitLitespeedList(m.Domain)})
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	for _, item := range conf.Vhosts {
+		vhosts = append(vhosts, &lsVhost{Name: item.Name, Root: item.Root, ConfigFile: item.ConfigFile})
+	}
+
+	return listeners, vhosts, nil
+}
+
+// expandLitespeedPath replaces OpenLiteSpeed path variables, and resolves
+// paths relative to the server root.
+func expandLitespeedPath(path, root string, vhost *lsVhost) string {
+	if !filepath.IsAbs(path) && !strings.HasPrefix(path, "$") {
+		path = filepath.Join(root, path)
+	}
+
+	return strings.NewReplacer(
+		"$SERVER_ROOT", root,
+		"$VH_NAME", vhost.Name,
+		"$VH_ROOT", vhost.Root,
+	).Replace(path)
+}
+
+// readDomains reads vhDomain/vhAliases from the vhost specific config. fsroot
+// is the filesystem root which the config is read from (see Finder.Root).
+func (vhost *lsVhost) readDomains(fsroot, root string) {
+	if vhost.ConfigFile == "" {
+		return
+	}
+
+	vhost.Root = expandLitespeedPath(vhost.Root, root, vhost)
+	vhost.ConfigFile = expandLitespeedPath(vhost.ConfigFile, root, vhost)
+	path := rootPath(fsroot, vhost.ConfigFile)
+
+	var domain, aliases string
+
+	if strings.HasSuffix(path, ".xml") {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return
+		}
+
+		conf := &lsXMLVhost{}
+		if err = xml.Unmarshal(raw, conf); err != nil {
+			return
+		}
+
+		domain, aliases = conf.Domain, conf.Aliases
+	} else {
+		conf, err := parseLitespeedPlain(path)
+		if err != nil {
+			return
+		}
+
+		domain, aliases = conf.get("vhDomain"), conf.get("vhAliases")
+	}
+
+	if domain != "" {
+		vhost.Domains = append(vhost.Domains, domain)
+	}
+	vhost.Domains = append(vhost.Domains, splitLitespeedList(aliases)...)
+}
+
+// litespeedServerRoot returns the OpenLiteSpeed server root based on the
+// running binary (e.g. /usr/local/lsws/bin/lshttpd -> /usr/local/lsws).
+func litespeedServerRoot(exe string) string {
+	if exe != "" {
+		return filepath.Dir(filepath.Dir(exe))
+	}
+
+	return litespeedRoot
+}
+
+// litespeedConfig returns the path to the OpenLiteSpeed configuration (within
+// fsroot), if it exists. LiteSpeed Enterprise uses Apache configuration files
+// instead.
+func litespeedConfig(fsroot, root string) string {
+	for _, name := range []string{"httpd_config.conf", "httpd_config.xml"} {
+		path := rootPath(fsroot, filepath.Join(root, "conf", name))
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// ReadLitespeedConfig parses the OpenLiteSpeed configuration (both the plain
+// text and legacy XML formats) within the server root, mapping listeners to
+// their vhosts.
+// docs: https://openlitespeed.org/kb/
+func (f *Finder) ReadLitespeedConfig(root string) ([]*Domain, error) {
+	path := litespeedConfig(f.Root, root)
+	if path == "" {
+		return nil, &NewErr{Code: ErrLitespeedReadConfig, value: filepath.Join(root, "conf/httpd_config.conf"), deepErr: os.ErrNotExist}
+	}
+
+	var listeners []*lsListener
+	var vhosts []*lsVhost
+	var err error
+
+	if strings.HasSuffix(path, ".xml") {
+		listeners, vhosts, err = readLitespeedXML(path)
+	} else {
+		listeners, vhosts, err = readLitespeedPlain(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vhostMap := make(map[string]*lsVhost, len(vhosts))
+	for _, vhost := range vhosts {
+		vhost.readDomains(f.Root, root)
+		vhostMap[vhost.Name] = vhost
+	}
+
+	// we'll want to get the hostname to test against (e.g. we want to ignore hostname urls)
+	hostname := utils.GetHostname(f.Root)
+
+	var domains []*Domain
+
+	for _, listener := range listeners {
+		f.Log.Printf("found litespeed listener: %s", listener)
+
+		ip, port := splitApacheAddr(listener.Address, "")
+		if !isPort(port) {
+			f.Log.Printf("unable to parse litespeed listener address: %s", listener)
+			continue
+		}
+
+		if isWildcardIP(ip) {
+			ip = localIP
+		} else if net.ParseIP(ip) == nil {
+			f.Log.Printf("skipping litespeed listener address: %s", listener)
+			continue
+		}
+
+		for _, m := range listener.Maps {
+			names := m.Domains
+			if len(names) == 1 && names[0] == "*" {
+				// catch-all mapping, so use the domains from the vhost itself.
+				vhost, ok := vhostMap[m.Vhost]
+				if !ok || len(vhost.Domains) == 0 {
+					f.Log.Printf("litespeed vhost %q mapped to listener %q as catch-all, but has no vhDomain", m.Vhost, listener.Name)
+					continue
+				}
+
+				names = vhost.Domains
+			}
+
+			for _, name := range names {
+				if name == "*" || name == "localhost" || utils.IsIP(name) || name == hostname {
+					continue
+				}
+
+				host := name
+				if listener.Secure {
+					host = "https://" + name
+				}
+
+				domainURL, err := utils.IsDomainURL(host, port)
+				if err != nil {
+					f.Log.Printf("unable to parse litespeed domain %s (port %s): %s", name, port, err)
+					continue
+				}
+
+				dom := &Domain{IP: ip, Port: port, URL: domainURL, Webserver: "litespeed"}
+				if vhost, ok := vhostMap[m.Vhost]; ok {
+					dom.DocRoot, dom.ConfigFile = vhost.Root, vhost.ConfigFile
+				}
+
+				domains = append(domains, dom)
+			}
+		}
+	}
+
+	if len(domains) == 0 {
+		return nil, &NewErr{Code: ErrLitespeedNoEntries}
+	}
+
+	stripDups(&domains)
+	stripPredefined(&domains)
+
+	return domains, nil
+}
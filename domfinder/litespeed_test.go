@@ -0,0 +1,76 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestReadLitespeedConfig(t *testing.T) {
+	cases := []struct {
+		root string
+		want []string // "url ip"; nil if an error is expected
+		code int      // error code, if one is expected
+	}{
+		{root: "plain", want: []string{
+			"http://example.com 127.0.0.1",
+			"http://www.example.com 127.0.0.1",
+			"http://shop.example.org 127.0.0.1",
+			"http://www.shop.example.org 127.0.0.1",
+			"http://blog.example.net 127.0.0.1",
+			"http://www.blog.example.net 127.0.0.1",
+			"http://news.example.net 127.0.0.1",
+			"https://shop.example.org 10.0.0.5",
+		}},
+		{root: "xml", want: []string{
+			"http://example.com:8088 127.0.0.1",
+			"http://www.example.com:8088 127.0.0.1",
+			"https://example.com 10.0.0.5",
+			"https://www.example.com 10.0.0.5",
+		}},
+		{root: "template", want: []string{
+			"http://blog.example.net 127.0.0.1",
+			"https://blog.example.net 10.0.0.5",
+		}},
+		{root: "empty", code: ErrLitespeedNoEntries},
+		{root: "unbalanced", code: ErrLitespeedParseConfig},
+		{root: "does-not-exist", code: ErrLitespeedReadConfig},
+	}
+
+	for _, c := range cases {
+		f := &Finder{Log: log.New(ioutil.Discard, "", 0)}
+		domains, err := f.ReadLitespeedConfig("testdata/litespeed/" + c.root)
+
+		if c.want == nil {
+			if err == nil {
+				t.Fatalf("ReadLitespeedConfig(%q) returned no error, wanted code %d", c.root, c.code)
+			}
+
+			if code := err.(Err).GetCode(); code != c.code {
+				t.Fatalf("ReadLitespeedConfig(%q) == %q (code %d), wanted code %d", c.root, err, code, c.code)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("ReadLitespeedConfig(%q) returned error: %s", c.root, err)
+		}
+
+		var out []string
+		for _, dom := range domains {
+			out = append(out, dom.URL.String()+" "+dom.IP)
+		}
+
+		if !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("ReadLitespeedConfig(%q) == %q, wanted %q", c.root, out, c.want)
+		}
+	}
+
+	return
+}
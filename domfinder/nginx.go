@@ -0,0 +1,604 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+// maxNginxIncludeDepth is how deep we follow nested include directives,
+// which prevents include loops from recursing forever.
+const maxNginxIncludeDepth = 10
+
+// maxNginxConfSize is the largest file we include when building a
+// configuration dump from the files on disk.
+const maxNginxConfSize = 1024 * 1024
+
+// nginxConfigPaths are the common locations of the main nginx configuration
+// file, used when we can't (or shouldn't) run "nginx -T".
+var nginxConfigPaths = [...]string{
+	"/etc/nginx/nginx.conf",
+	"/usr/local/nginx/conf/nginx.conf",
+	"/usr/local/etc/nginx/nginx.conf",
+}
+
+// nginxConfFile represents a single configuration file within the output of
+// "nginx -T".
+type nginxConfFile struct {
+	name string // path of the configuration file
+	body string // contents of the configuration file
+}
+
+// nginxDirective represents a single directive (and its block, if it has one)
+// within an nginx configuration.
+type nginxDirective struct {
+	name  string
+	args  []string
+	block []*nginxDirective
+	file  string
+	line  int
+}
+
+// nginxListen represents a single "listen" directive within a server block.
+type nginxListen struct {
+	IP      string
+	Port    string
+	SSL     bool
+	Default bool
+}
+
+func (l *nginxListen) String() string {
+	return fmt.Sprintf("<[nginx listen] ip:%q port:%q ssl:%t default:%t>", l.IP, l.Port, l.SSL, l.Default)
+}
+
+// nginxServer represents a parsed "server" block.
+type nginxServer struct {
+	Names   []string
+	Listen  []*nginxListen
+	Root    string
+	File    string
+	Line    int
+	Default bool
+}
+
+func (s *nginxServer) String() string {
+	return fmt.Sprintf("<[nginx server] names:%q listen:%s file:%s:%d default:%t>", s.Names, s.Listen, s.File, s.Line, s.Default)
+}
+
+var reNginxConfFile = regexp.MustCompile(`(?m)^# configuration file (.+):[ \t]*$`)
+
+// splitNginxDump splits the output of "nginx -T" into the configuration files
+// it is comprised of. The first file is the main configuration file.
+func splitNginxDump(raw string) (files []*nginxConfFile) {
+	indexes := reNginxConfFile.FindAllStringSubmatchIndex(raw, -1)
+
+	for i, index := range indexes {
+		end := len(raw)
+		if i+1 < len(indexes) {
+			end = indexes[i+1][0]
+		}
+
+		files = append(files, &nginxConfFile{
+			name: raw[index[2]:index[3]],
+			body: raw[index[1]:end],
+		})
+	}
+
+	return files
+}
+
+type nginxToken struct {
+	value  string
+	quoted bool
+	line   int
+}
+
+// tokenizeNginx splits an nginx configuration file into a list of tokens,
+// stripping comments along the way.
+func tokenizeNginx(conf *nginxConfFile) ([]*nginxToken, error) {
+	var tokens []*nginxToken
+	var buf []rune
+	// the body starts with the newline trailing the "# configuration file"
+	// header, so the first line of the file is line 1.
+	var line int
+
+	flush := func() {
+		if len(buf) > 0 {
+			tokens = append(tokens, &nginxToken{value: string(buf), line: line})
+			buf = nil
+		}
+	}
+
+	in := []rune(conf.body)
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+
+		switch {
+		case c == '\n':
+			flush()
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+		case c == '#' && len(buf) == 0:
+			// comment, skip until the end of the line.
+			for i+1 < len(in) && in[i+1] != '\n' {
+				i++
+			}
+		case c == ';' || c == '{' || c == '}':
+			flush()
+			tokens = append(tokens, &nginxToken{value: string(c), line: line})
+		case (c == '"' || c == '\'') && len(buf) == 0:
+			start := line
+			var quoted []rune
+			closed := false
+
+			for i++; i < len(in); i++ {
+				if in[i] == '\\' && i+1 < len(in) {
+					i++
+					quoted = append(quoted, in[i])
+					continue
+				}
+				if in[i] == c {
+					closed = true
+					break
+				}
+				if in[i] == '\n' {
+					line++
+				}
+				quoted = append(quoted, in[i])
+			}
+
+			if !closed {
+				return nil, &NewErr{Code: ErrNginxParseVhosts, value: fmt.Sprintf("%s (line %d): unterminated quote", conf.name, start)}
+			}
+
+			tokens = append(tokens, &nginxToken{value: string(quoted), quoted: true, line: start})
+		default:
+			buf = append(buf, c)
+		}
+	}
+	flush()
+
+	return tokens, nil
+}
+
+// nginxParser converts the nginx configuration files into a tree of directives,
+// splicing in the contents of any included files.
+type nginxParser struct {
+	files  map[string]*nginxConfFile
+	prefix string // directory relative includes are based off of
+}
+
+func (p *nginxParser) parseFile(conf *nginxConfFile, depth int) ([]*nginxDirective, error) {
+	tokens, err := tokenizeNginx(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := 0
+	block, err := p.parseBlock(conf, tokens, &pos, depth, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+func (p *nginxParser) parseBlock(conf *nginxConfFile, tokens []*nginxToken, pos *int, depth int, nested bool) (block []*nginxDirective, err error) {
+	var current *nginxDirective
+
+	for ; *pos < len(tokens); *pos++ {
+		tok := tokens[*pos]
+
+		if tok.quoted {
+			if current == nil {
+				current = &nginxDirective{name: tok.value, file: conf.name, line: tok.line}
+				continue
+			}
+
+			current.args = append(current.args, tok.value)
+			continue
+		}
+
+		switch tok.value {
+		case ";":
+			if current == nil {
+				continue // stray semicolon
+			}
+
+			if current.name == "include" && len(current.args) > 0 {
+				included, err := p.include(current, depth)
+				if err != nil {
+					return nil, err
+				}
+
+				block = append(block, included...)
+				current = nil
+				continue
+			}
+
+			block = append(block, current)
+			current = nil
+		case "{":
+			if current == nil {
+				return nil, &NewErr{Code: ErrNginxParseVhosts, value: fmt.Sprintf("%s (line %d): unexpected '{'", conf.name, tok.line)}
+			}
+
+			*pos++
+			if current.block, err = p.parseBlock(conf, tokens, pos, depth, true); err != nil {
+				return nil, err
+			}
+
+			block = append(block, current)
+			current = nil
+		case "}":
+			if !nested {
+				return nil, &NewErr{Code: ErrNginxParseVhosts, value: fmt.Sprintf("%s (line %d): unexpected '}'", conf.name, tok.line)}
+			}
+
+			return block, nil
+		default:
+			if current == nil {
+				current = &nginxDirective{name: tok.value, file: conf.name, line: tok.line}
+				continue
+			}
+
+			current.args = append(current.args, tok.value)
+		}
+	}
+
+	if nested {
+		return nil, &NewErr{Code: ErrNginxParseVhosts, value: fmt.Sprintf("%s: unexpected end of file, missing '}'", conf.name)}
+	}
+
+	return block, nil
+}
+
+// include resolves the files an include directive references (against the
+// files which were provided within the dump), and returns their directives.
+func (p *nginxParser) include(dir *nginxDirective, depth int) (block []*nginxDirective, err error) {
+	if depth >= maxNginxIncludeDepth {
+		return nil, &NewErr{Code: ErrNginxParseVhosts, value: fmt.Sprintf("%s (line %d): includes nested too deep", dir.file, dir.line)}
+	}
+
+	pattern := dir.args[0]
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(p.prefix, pattern)
+	}
+
+	var names []string
+	for name := range p.files {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	// nginx includes files in lexical order when globbing.
+	sort.Strings(names)
+
+	for _, name := range names {
+		included, err := p.parseFile(p.files[name], depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		block = append(block, included...)
+	}
+
+	return block, nil
+}
+
+// parseNginxListen parses the arguments of an nginx "listen" directive.
+// docs: http://nginx.org/en/docs/http/ngx_http_core_module.html#listen
+func parseNginxListen(args []string) (*nginxListen, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("listen directive missing address")
+	}
+
+	addr := args[0]
+	if strings.HasPrefix(addr, "unix:") {
+		return nil, fmt.Errorf("unix socket %q isn't supported", addr)
+	}
+
+	listen := &nginxListen{IP: "*", Port: "80"}
+
+	switch {
+	case strings.HasPrefix(addr, "["):
+		// ipv6, e.g. "[::]:80" or "[::1]"
+		end := strings.Index(addr, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid ipv6 address %q", addr)
+		}
+
+		listen.IP = addr[1:end]
+		if strings.HasPrefix(addr[end+1:], ":") {
+			listen.Port = addr[end+2:]
+		}
+	case strings.Contains(addr, ":"):
+		listen.IP, listen.Port, _ = net.SplitHostPort(addr)
+	case isPort(addr):
+		listen.Port = addr
+	default:
+		listen.IP = addr
+	}
+
+	if !isPort(listen.Port) {
+		return nil, fmt.Errorf("invalid port in listen address %q", addr)
+	}
+
+	for _, flag := range args[1:] {
+		switch flag {
+		case "ssl":
+			listen.SSL = true
+		case "default_server", "default":
+			listen.Default = true
+		case "quic":
+			return nil, fmt.Errorf("quic listener %q isn't supported", addr)
+		}
+	}
+
+	return listen, nil
+}
+
+// isPort returns true if the string is a valid numeric port.
+func isPort(port string) bool {
+	num, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+
+	return num > 0 && num < 65536
+}
+
+// nginxServers walks the directive tree, returning all of the http server
+// blocks.
+func nginxServers(block []*nginxDirective) (servers []*nginxServer) {
+	for _, dir := range block {
+		if dir.name != "http" {
+			continue
+		}
+
+		for _, sdir := range dir.block {
+			if sdir.name != "server" {
+				continue
+			}
+
+			server := &nginxServer{File: sdir.file, Line: sdir.line}
+			var sslOn, hasListen bool
+
+			for _, item := range sdir.block {
+				switch item.name {
+				case "server_name":
+					server.Names = append(server.Names, item.args...)
+				case "root":
+					if len(item.args) > 0 {
+						server.Root = item.args[0]
+					}
+				case "ssl":
+					sslOn = len(item.args) > 0 && item.args[0] == "on"
+				case "listen":
+					hasListen = true
+					listen, err := parseNginxListen(item.args)
+					if err != nil {
+						continue
+					}
+
+					server.Listen = append(server.Listen, listen)
+				}
+			}
+
+			if !hasListen {
+				// nginx listens on *:80 when no listen directive is supplied.
+				server.Listen = append(server.Listen, &nginxListen{IP: "*", Port: "80"})
+			}
+
+			for _, listen := range server.Listen {
+				if sslOn {
+					listen.SSL = true
+				}
+
+				if listen.Default {
+					server.Default = true
+				}
+			}
+
+			servers = append(servers, server)
+		}
+	}
+
+	return servers
+}
+
+// nginxDumpFromDisk builds the equivalent of "nginx -T" from the files on disk
+// (within fsroot), using the main configuration file, followed by all files
+// it includes (recursively), wherever they are.
+func nginxDumpFromDisk(fsroot string) (string, error) {
+	var conf string
+	for _, path := range nginxConfigPaths {
+		if _, err := os.Stat(rootPath(fsroot, path)); err == nil {
+			conf = path
+			break
+		}
+	}
+
+	if conf == "" {
+		return "", &NewErr{Code: ErrNginxReadConfig, value: nginxConfigPaths[0], deepErr: os.ErrNotExist}
+	}
+
+	var buf bytes.Buffer
+	seen := make(map[string]bool)
+
+	var add func(name string) error
+	add = func(name string) error {
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+
+		raw, err := ioutil.ReadFile(rootPath(fsroot, name))
+		if err != nil {
+			return &NewErr{Code: ErrNginxReadConfig, value: name, deepErr: err}
+		}
+
+		fmt.Fprintf(&buf, "# configuration file %s:\n%s\n", name, raw)
+
+		// syntax errors are reported when the dump is parsed.
+		tokens, err := tokenizeNginx(&nginxConfFile{name: name, body: string(raw)})
+		if err != nil {
+			return nil
+		}
+
+		for i := 0; i < len(tokens)-1; i++ {
+			if tokens[i].quoted || tokens[i].value != "include" {
+				continue
+			}
+
+			// only the name of a directive, not an argument named "include".
+			if i > 0 {
+				if prev := tokens[i-1]; prev.quoted || (prev.value != ";" && prev.value != "{" && prev.value != "}") {
+					continue
+				}
+			}
+
+			for _, included := range nginxInclude(fsroot, filepath.Dir(conf), tokens[i+1].value) {
+				if err := add(included); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	if err := add(conf); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// nginxInclude resolves the pattern of an include directive (relative to
+// prefix, if it isn't absolute) into the files on disk it matches.
+func nginxInclude(fsroot, prefix, pattern string) (files []string) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(prefix, pattern)
+	}
+
+	matches, err := filepath.Glob(rootPath(fsroot, pattern))
+	if err != nil {
+		return nil
+	}
+
+	for _, match := range matches {
+		info, err := os.Stat(resolveRoot(fsroot, match))
+		if err != nil || info.IsDir() || info.Size() > maxNginxConfSize {
+			continue
+		}
+
+		files = append(files, trimRoot(fsroot, match))
+	}
+
+	// nginx includes files in lexical order when globbing.
+	sort.Strings(files)
+
+	return files
+}
+
+// ReadNginxVhosts interprets and parses the "nginx -T" configuration dump.
+// docs: http://nginx.org/en/docs/switches.html
+func (f *Finder) ReadNginxVhosts(raw string) ([]*Domain, error) {
+	files := splitNginxDump(raw)
+	if len(files) == 0 {
+		return nil, &NewErr{Code: ErrNginxParseVhosts, value: "no configuration files found within dump"}
+	}
+
+	p := &nginxParser{
+		files:  make(map[string]*nginxConfFile, len(files)),
+		prefix: filepath.Dir(files[0].name),
+	}
+	for _, file := range files {
+		p.files[file.name] = file
+	}
+
+	tree, err := p.parseFile(files[0], 0)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := nginxServers(tree)
+	if len(servers) == 0 {
+		return nil, &NewErr{Code: ErrNginxNoEntries}
+	}
+
+	// we'll want to get the hostname to test against (e.g. we want to ignore hostname urls)
+	hostname := utils.GetHostname(f.Root)
+
+	var domains []*Domain
+
+	for _, server := range servers {
+		f.Log.Printf("found nginx server block: %s", server)
+
+		for _, name := range server.Names {
+			// ".example.com" is shorthand for "example.com *.example.com".
+			name = strings.TrimPrefix(name, ".")
+
+			if name == "" || name == "_" || name == "localhost" || strings.HasPrefix(name, "~") ||
+				strings.Contains(name, "$") || utils.IsIP(name) || name == hostname {
+				continue
+			}
+
+			for _, listen := range server.Listen {
+				ip := listen.IP
+				if isWildcardIP(ip) {
+					ip = localIP
+				} else if net.ParseIP(ip) == nil {
+					f.Log.Printf("skipping nginx listen address %s for %s (%s:%d)", listen, name, server.File, server.Line)
+					continue
+				}
+
+				host := name
+				if listen.SSL {
+					host = "https://" + name
+				}
+
+				domainURL, err := utils.IsDomainURL(host, listen.Port)
+				if err != nil {
+					f.Log.Printf("unable to parse nginx domain %s (port %s): %s", name, listen.Port, err)
+					continue
+				}
+
+				domains = append(domains, &Domain{
+					IP:         ip,
+					Port:       listen.Port,
+					URL:        domainURL,
+					DocRoot:    server.Root,
+					ConfigFile: server.File,
+					ConfigLine: server.Line,
+					Webserver:  "nginx",
+				})
+			}
+		}
+	}
+
+	stripDups(&domains)
+	stripPredefined(&domains)
+
+	return domains, nil
+}
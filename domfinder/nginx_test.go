@@ -0,0 +1,115 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestReadNginxVhosts(t *testing.T) {
+	cases := []struct {
+		fixture string
+		want    []string // "url ip"; nil if an error is expected
+		code    int      // error code, if one is expected
+	}{
+		{fixture: "basic.txt", want: []string{
+			"http://example.com 127.0.0.1",
+			"http://www.example.com 127.0.0.1",
+			"https://example.com 127.0.0.1",
+			"https://www.example.com 127.0.0.1",
+			"http://other.example.org:8080 10.0.0.5",
+			"https://other.example.org:8443 10.0.0.5",
+			"http://wild.example.net:8080 10.0.0.5",
+			"https://wild.example.net:8443 10.0.0.5",
+			"http://nolisten.example.com 127.0.0.1",
+			"https://legacy-ssl.example.com:8081 127.0.0.1",
+		}},
+		{fixture: "nested.txt", want: []string{
+			"http://shared.example.com 192.168.1.10",
+		}},
+		{fixture: "unbalanced.txt", code: ErrNginxParseVhosts},
+		{fixture: "quote.txt", code: ErrNginxParseVhosts},
+		{fixture: "empty.txt", code: ErrNginxNoEntries},
+	}
+
+	for _, c := range cases {
+		raw, err := ioutil.ReadFile("testdata/nginx/" + c.fixture)
+		if err != nil {
+			t.Fatalf("unable to read fixture %s: %s", c.fixture, err)
+		}
+
+		f := &Finder{Log: log.New(ioutil.Discard, "", 0)}
+		domains, err := f.ReadNginxVhosts(string(raw))
+
+		if c.want == nil {
+			if err == nil {
+				t.Fatalf("ReadNginxVhosts(%s) returned no error, wanted code %d", c.fixture, c.code)
+			}
+
+			if code := err.(Err).GetCode(); code != c.code {
+				t.Fatalf("ReadNginxVhosts(%s) == %q (code %d), wanted code %d", c.fixture, err, code, c.code)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("ReadNginxVhosts(%s) returned error: %s", c.fixture, err)
+		}
+
+		var out []string
+		for _, dom := range domains {
+			out = append(out, dom.URL.String()+" "+dom.IP)
+		}
+
+		if !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("ReadNginxVhosts(%s) == %q, wanted %q", c.fixture, out, c.want)
+		}
+	}
+
+	return
+}
+
+func TestParseNginxListen(t *testing.T) {
+	cases := []struct {
+		in   []string
+		want *nginxListen // nil if an error is expected
+	}{
+		{in: []string{"80"}, want: &nginxListen{IP: "*", Port: "80"}},
+		{in: []string{"1.2.3.4"}, want: &nginxListen{IP: "1.2.3.4", Port: "80"}},
+		{in: []string{"1.2.3.4:8080", "default_server"}, want: &nginxListen{IP: "1.2.3.4", Port: "8080", Default: true}},
+		{in: []string{"*:443", "ssl", "http2"}, want: &nginxListen{IP: "*", Port: "443", SSL: true}},
+		{in: []string{"[::]:443", "ssl", "default"}, want: &nginxListen{IP: "::", Port: "443", SSL: true, Default: true}},
+		{in: []string{"[::1]"}, want: &nginxListen{IP: "::1", Port: "80"}},
+		{in: []string{"unix:/var/run/nginx.sock"}},
+		{in: []string{"443", "quic"}},
+		{in: []string{"1.2.3.4:99999"}},
+		{in: []string{}},
+	}
+
+	for _, c := range cases {
+		out, err := parseNginxListen(c.in)
+
+		if c.want == nil {
+			if err == nil {
+				t.Fatalf("parseNginxListen(%q) == %s, wanted error", c.in, out)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("parseNginxListen(%q) returned error: %s", c.in, err)
+		}
+
+		if !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("parseNginxListen(%q) == %s, wanted %s", c.in, out, c.want)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,153 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDirectAdminUsers(t *testing.T) {
+	f := &Finder{Log: log.New(ioutil.Discard, "", 0)}
+	domains, err := f.readDirectAdminUsers("testdata/directadmin/users")
+	if err != nil {
+		t.Fatalf("readDirectAdminUsers() returned error: %s", err)
+	}
+
+	var out []string
+	for _, dom := range domains {
+		out = append(out, dom.URL.String()+" "+dom.IP)
+	}
+
+	want := []string{
+		"http://example.com 10.0.0.5",
+		"http://blog.example.com 10.0.0.5",
+		"http://shop.example.com 10.0.0.5",
+		"http://alias.example.org 10.0.0.5",
+		"https://example.com 10.0.0.5",
+		"https://blog.example.com 10.0.0.5",
+		"https://shop.example.com 10.0.0.5",
+		"https://alias.example.org 10.0.0.5",
+		"http://example.net 10.0.0.6",
+		"http://dave.example.com 10.0.0.8",
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("readDirectAdminUsers() == %q, wanted %q", out, want)
+	}
+
+	return
+}
+
+func TestReadPleskVhosts(t *testing.T) {
+	f := &Finder{Log: log.New(ioutil.Discard, "", 0)}
+	domains, err := f.readPleskVhosts("testdata/plesk/system")
+	if err != nil {
+		t.Fatalf("readPleskVhosts() returned error: %s", err)
+	}
+
+	var out []string
+	for _, dom := range domains {
+		out = append(out, dom.URL.String()+" "+dom.IP)
+	}
+
+	want := []string{
+		"https://example.com 10.0.0.5",
+		"https://www.example.com 10.0.0.5",
+		"http://example.com 10.0.0.5",
+		"http://www.example.com 10.0.0.5",
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("readPleskVhosts() == %q, wanted %q", out, want)
+	}
+
+	return
+}
+
+func TestReadCpanelVars(t *testing.T) {
+	f := &Finder{Root: "testdata/cpanel", Log: log.New(ioutil.Discard, "", 0)}
+	domains, err := f.ReadCpanelVars()
+	if err != nil {
+		t.Fatalf("ReadCpanelVars() returned error: %s", err)
+	}
+
+	var out []string
+	for _, dom := range domains {
+		out = append(out, dom.URL.String()+" "+dom.IP+" "+dom.Type+" "+dom.User+" "+dom.DocRoot)
+	}
+
+	want := []string{
+		"http://example.com 10.0.0.5 main bob /home/bob/public_html",
+		"http://www.example.com 10.0.0.5 main bob /home/bob/public_html",
+		"https://example.com 10.0.0.5 main bob /home/bob/public_html",
+		"https://www.example.com 10.0.0.5 main bob /home/bob/public_html",
+		"http://example.org 10.0.0.5 parked bob /home/bob/public_html",
+		"http://www.example.org 10.0.0.5 parked bob /home/bob/public_html",
+		"https://example.org 10.0.0.5 parked bob /home/bob/public_html",
+		"https://www.example.org 10.0.0.5 parked bob /home/bob/public_html",
+		"http://blog.example.com 10.0.0.5 sub bob /home/bob/public_html/blog",
+		"http://www.blog.example.com 10.0.0.5 sub bob /home/bob/public_html/blog",
+		"http://shop.example.com 10.0.0.5 sub bob /home/bob/shop.net",
+		"http://www.shop.example.com 10.0.0.5 sub bob /home/bob/shop.net",
+		"http://shop.net 10.0.0.5 addon bob /home/bob/shop.net",
+		"http://www.shop.net 10.0.0.5 addon bob /home/bob/shop.net",
+		"http://old.example.com 10.0.0.5 sub bob /home/bob/old",
+		"http://www.old.example.com 10.0.0.5 sub bob /home/bob/old",
+		"http://alice.com 2001:db8::5 main alice /home/alice/public_html",
+		"http://www.alice.com 2001:db8::5 main alice /home/alice/public_html",
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("ReadCpanelVars() == %q, wanted %q", out, want)
+	}
+
+	suspended := f.readCpanelSuspended()
+	if want := map[string]bool{"eve": true, "carl": true}; !reflect.DeepEqual(suspended, want) {
+		t.Fatalf("readCpanelSuspended() == %v, wanted %v", suspended, want)
+	}
+
+	return
+}
+
+func TestParseCpanelUserdataDomain(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string // "name user type parent ip port sslip sslport"; empty if an error is expected
+	}{
+		{"example.com: bob==root==main==example.com==/home/bob/public_html==10.0.0.5:80==10.0.0.5:443==1==0==0", "example.com bob main example.com 10.0.0.5 80 10.0.0.5 443"},
+		{"Shop.net: bob==root==addon==shop.example.com==/home/bob/shop.net==10.0.0.5:80====1", "shop.net bob addon shop.example.com 10.0.0.5 80  "},
+		{"v6.com: bob==root==main==v6.com==/home/bob/public_html==[2001:db8::5]:80==[2001:db8::5]:443", "v6.com bob main v6.com 2001:db8::5 80 2001:db8::5 443"},
+		{"example.com: bob==root==main", ""},
+		{"example.com: bob==root==main==example.com==/home/bob==10.0.0.5", ""},
+		{"example.com bob", ""},
+	}
+
+	for _, c := range cases {
+		dom, err := parseCpanelUserdataDomain(c.in)
+
+		if c.want == "" {
+			if err == nil {
+				t.Fatalf("parseCpanelUserdataDomain(%q) == %s, wanted error", c.in, dom)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("parseCpanelUserdataDomain(%q) returned error: %s", c.in, err)
+		}
+
+		out := strings.Join([]string{dom.Name, dom.User, dom.Type, dom.Parent, dom.IP, dom.Port, dom.SSLIP, dom.SSLPort}, " ")
+		if out != c.want {
+			t.Fatalf("parseCpanelUserdataDomain(%q) == %q, wanted %q", c.in, out, c.want)
+		}
+	}
+
+	return
+}
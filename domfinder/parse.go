@@ -5,144 +5,29 @@
 package domfinder
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/lrstanley/marill/utils"
 )
 
-var reIP = regexp.MustCompile(`^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}$`)
-
-// cpanelVhost represents a /var/cpanel/userdata/<user>/<domain>.cache file.
-type cpanelVhost struct {
-	Servername   string
-	Serveralias  string
-	Homedir      string
-	User         string
-	IP           string
-	Documentroot string
-	Port         string
-}
-
-func (vhost *cpanelVhost) String() string {
-	return fmt.Sprintf("<[cPanel dom] home:%q user:%q ip:%q docroot:%q port:%q name:%q alias:%q>", vhost.Homedir, vhost.User, vhost.IP, vhost.Documentroot, vhost.Port, vhost.Servername, vhost.Serveralias)
-}
-
-// ReadCpanelVars crawls through /var/cpanel/userdata/ and returns all valid
-// domains/ports that the cPanel server is hosting
-func (f *Finder) ReadCpanelVars() error {
-	cphosts, err := filepath.Glob("/var/cpanel/userdata/[a-z0-9_]*/*.*.cache")
-
-	if err != nil {
-		return err
-	}
-
-	var suspended []string
-	var domains []*Domain
-	for i := range cphosts {
-		raw, err := ioutil.ReadFile(cphosts[i])
-		if err != nil {
-			f.Log.Printf("unable to read file '%s' during domain search: %s", cphosts[i], err)
-			continue
-		}
-
-		vhost := &cpanelVhost{}
-
-		err = json.Unmarshal(raw, &vhost)
-		if err != nil {
-			f.Log.Printf("unable to parse json in file '%s' during domain search: %s", cphosts[i], err)
-			continue
-		}
-
-		if vhost.User == "nobody" || reIP.MatchString(vhost.Servername) {
-			// assume it's an invalid user or it's an ip. we can ignore.
-			f.Log.Printf("found invalid vhost during domain search, skipping: %s", vhost)
-			continue
-		}
-
-		// check to see if the user is suspended
-		var isSuspended bool
-		for s := 0; s < len(suspended); s++ {
-			if vhost.User == suspended[s] {
-				isSuspended = true
-				break
-			}
-		}
-		if isSuspended {
-			f.Log.Printf("cPanel user '%s' is suspended. skipping vhost. (from %s)", vhost.User, vhost)
-			continue // outright skip
-		}
-
-		// actually get the cPanel user data
-		cpuser, err := ioutil.ReadFile(fmt.Sprintf("/var/cpanel/users/%s", vhost.User))
-		if err != nil {
-			f.Log.Printf("unable to read user file '%s' during domain search, skipping: %s", fmt.Sprintf("/var/cpanel/users/%s", vhost.User), vhost)
-			continue
-		}
-
-		// TODO: This can be cached.
-		if strings.Contains(string(cpuser), "SUSPENDED=1") {
-			// assume they are suspended
-			suspended = append(suspended, vhost.User)
-			f.Log.Printf("cPanel user '%s' is suspended. skipping vhost. (from %s)", vhost.User, vhost)
-			continue
-		}
-
-		domainURL, err := utils.IsDomainURL(vhost.Servername, vhost.Port)
-		if err != nil {
-			// assume the actual domain is invalid
-			f.Log.Printf("invalid uri from cPanel vhost: %s", vhost)
-			continue
-		}
-
-		domains = append(domains, &Domain{
-			IP:   vhost.IP,
-			Port: vhost.Port,
-			URL:  domainURL,
-		})
-
-		for _, subvhost := range strings.Split(vhost.Serveralias, " ") {
-			subURL, err := utils.IsDomainURL(subvhost, vhost.Port)
-			if err != nil {
-				// assume bad domain
-				f.Log.Printf("invalid uri from cPanel vhost: %s (from: %q)", subvhost, strings.Split(vhost.Serveralias, " "))
-				continue
-			}
-
-			domains = append(domains, &Domain{
-				IP:   vhost.IP,
-				Port: vhost.Port,
-				URL:  subURL,
-			})
-		}
-	}
-
-	stripDups(&domains)
-	stripPredefined(&domains)
-	f.Domains = domains
-
-	return nil
-}
-
-var reNameVhost = regexp.MustCompile(`\s+ port (\d{2,5}) namevhost ([^ ]+)`)
+var reNameVhost = regexp.MustCompile(`\s+ port (\d{2,5}) namevhost ([^ \n]+)(?: \((.+):(\d+)\))?`)
 
 // ReadApacheVhosts interprets and parses the "httpd -S" directive entries.
 // docs: http://httpd.apache.org/docs/current/vhosts/#directives
-func (f *Finder) ReadApacheVhosts(raw string) error {
+func (f *Finder) ReadApacheVhosts(raw string) ([]*Domain, error) {
 	// some regex patterns to pull out data from the vhost results
-	reVhostblock := regexp.MustCompile(`(?sm:^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}\:\d{2,5} \s+is a NameVirtualHost)`)
+	reVhostblock := regexp.MustCompile(`(?sm:^(?:\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}|\[[0-9A-Fa-f:.]+\])\:\d{2,5} \s+is a NameVirtualHost)`)
 	reStripvars := regexp.MustCompile(`(?ms:[\w-]+: .*$)`)
-	reVhostipport := regexp.MustCompile(`^(\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3})\:(\d{2,5})\s+`)
+	reVhostipport := regexp.MustCompile(`^(?:(\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3})|\[([0-9A-Fa-f:.]+)\])\:(\d{2,5})\s+`)
 
 	// save the original, in case we need it
 	original := raw
 
 	// we'll want to get the hostname to test against (e.g. we want to ignore hostname urls)
-	hostname := utils.GetHostname()
+	hostname := utils.GetHostname(f.Root)
 
 	var domains []*Domain
 
@@ -181,7 +66,7 @@ func (f *Finder) ReadApacheVhosts(raw string) error {
 	}
 
 	if len(results) == 0 {
-		return &NewErr{Code: ErrApacheNoEntries}
+		return nil, &NewErr{Code: ErrApacheNoEntries}
 	}
 
 	// now we should have a list of loaded virtual host blocks.
@@ -191,13 +76,14 @@ func (f *Finder) ReadApacheVhosts(raw string) error {
 
 		rawipport := reVhostipport.FindAllStringSubmatch(rvhost, -1)
 		if len(rawipport) == 0 {
-			return &NewErr{Code: ErrApacheParseVhosts, value: fmt.Sprintf("line %d", line)}
+			return nil, &NewErr{Code: ErrApacheParseVhosts, value: fmt.Sprintf("line %d", line)}
 		}
 
-		ip := rawipport[0][1]
-		port := rawipport[0][2]
+		// ipv4, or ipv6 (e.g. "[2001:db8::1]:443"), without the brackets.
+		ip := rawipport[0][1] + rawipport[0][2]
+		port := rawipport[0][3]
 		if len(ip) == 0 || len(port) == 0 {
-			return &NewErr{Code: ErrApacheParseVhosts, value: fmt.Sprintf("line %d, unable to determine ip/port", line)}
+			return nil, &NewErr{Code: ErrApacheParseVhosts, value: fmt.Sprintf("line %d, unable to determine ip/port", line)}
 		}
 
 		tmp := reNameVhost.FindAllStringSubmatch(rvhost, -1)
@@ -211,7 +97,7 @@ func (f *Finder) ReadApacheVhosts(raw string) error {
 			domainPort := item[1]
 			domainName := item[2]
 
-			if len(domainPort) == 0 || len(domainName) == 0 || reIP.MatchString(domainName) || hostname == domainName {
+			if len(domainPort) == 0 || len(domainName) == 0 || utils.IsIP(domainName) || hostname == domainName {
 				// assume that we didn't parse the string properly
 				f.Log.Printf("unable to parse apache domain %s (port %s) during domain search", domainName, domainPort)
 				continue
@@ -228,10 +114,13 @@ func (f *Finder) ReadApacheVhosts(raw string) error {
 			}
 
 			dom := &Domain{
-				IP:   ip,
-				Port: domainPort,
-				URL:  domainURL,
+				IP:         ip,
+				Port:       domainPort,
+				URL:        domainURL,
+				ConfigFile: item[3],
+				Webserver:  "apache",
 			}
+			dom.ConfigLine, _ = strconv.Atoi(item[4])
 
 			domains = append(domains, dom)
 		}
@@ -239,7 +128,6 @@ func (f *Finder) ReadApacheVhosts(raw string) error {
 
 	stripDups(&domains)
 	stripPredefined(&domains)
-	f.Domains = domains
 
-	return nil
+	return domains, nil
 }
@@ -0,0 +1,81 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// pleskVhosts is where Plesk stores the generated per-domain webserver
+// configuration (e.g. /var/www/vhosts/system/<domain>/conf/httpd.conf).
+const pleskVhosts = "/var/www/vhosts/system"
+
+// pleskSuspended returns true if the vhost is being served Plesk's default
+// pages (e.g. /var/www/vhosts/default/htdocs), rather than the domain's own
+// document root, which is the case for suspended and disabled domains.
+func pleskSuspended(vhost *apacheVhost) bool {
+	if vhost.DocRoot == "" {
+		return false
+	}
+
+	docroot := filepath.Clean(vhost.DocRoot)
+
+	return filepath.Base(docroot) == "htdocs" && filepath.Base(filepath.Dir(docroot)) == "default"
+}
+
+// ReadPleskVhosts crawls through /var/www/vhosts/system/ and returns all
+// valid domains/ports that the Plesk server is hosting.
+func (f *Finder) ReadPleskVhosts() ([]*Domain, error) {
+	return f.readPleskVhosts(f.path(pleskVhosts))
+}
+
+func (f *Finder) readPleskVhosts(dir string) ([]*Domain, error) {
+	confs, err := filepath.Glob(filepath.Join(dir, "*", "conf", "httpd.conf"))
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []*Domain
+	for _, conf := range confs {
+		conf = trimRoot(f.Root, conf)
+		c := newApacheConfig(f.Root, filepath.Dir(conf))
+
+		if err := c.parseFile(f, conf, 0); err != nil {
+			f.Log.Printf("unable to parse Plesk vhost config '%s' during domain search, skipping: %s", conf, err)
+			continue
+		}
+
+		var vhosts []*apacheVhost
+		for _, vhost := range c.vhosts {
+			if pleskSuspended(vhost) {
+				f.Log.Printf("Plesk vhost is suspended or disabled. skipping vhost. (from %s)", vhost)
+				continue
+			}
+
+			// plesk adds "ipv4.<domain>" aliases to all vhosts, which
+			// generally don't resolve.
+			var names []string
+			for _, name := range vhost.Names {
+				if !strings.HasPrefix(name, "ipv4.") {
+					names = append(names, name)
+				}
+			}
+			vhost.Names = names
+
+			vhosts = append(vhosts, vhost)
+		}
+
+		for _, dom := range f.apacheConfigDomains(c, vhosts) {
+			dom.Panel = "plesk"
+			domains = append(domains, dom)
+		}
+	}
+
+	stripDups(&domains)
+	stripPredefined(&domains)
+
+	return domains, nil
+}
@@ -0,0 +1,60 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRoot(t *testing.T) {
+	cases := []struct {
+		root string
+		want []string // "url ip source"
+	}{
+		{root: "cpanel", want: []string{
+			"http://example.com 10.0.0.5 cpanel",
+			"http://www.example.com 10.0.0.5 cpanel",
+			"https://example.com 10.0.0.5 cpanel",
+			"https://www.example.com 10.0.0.5 cpanel",
+		}},
+		{root: "nginx", want: []string{
+			"http://example.org 127.0.0.1 nginx",
+			"https://example.org 127.0.0.1 nginx",
+			"http://www.example.org 127.0.0.1 nginx",
+			"https://www.example.org 127.0.0.1 nginx",
+			"http://shop.example.org 127.0.0.1 nginx", // included from outside of /etc/nginx
+		}},
+		{root: "apache", want: []string{
+			"http://example.net:8080 127.0.0.1 apache",
+			"http://www.example.net:8080 127.0.0.1 apache",
+		}},
+	}
+
+	for _, c := range cases {
+		f := &Finder{Root: "testdata/snapshots/" + c.root, Log: log.New(ioutil.Discard, "", 0)}
+
+		if err := f.GetWebservers(); err != nil {
+			t.Fatalf("GetWebservers(%s) returned error: %s", c.root, err)
+		}
+
+		if err := f.GetDomains(); err != nil {
+			t.Fatalf("GetDomains(%s) returned error: %s", c.root, err)
+		}
+
+		var out []string
+		for _, dom := range f.Domains {
+			out = append(out, dom.URL.String()+" "+dom.IP+" "+dom.Source)
+		}
+
+		if !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("GetDomains(%s) == %q, wanted %q", c.root, out, c.want)
+		}
+	}
+
+	return
+}
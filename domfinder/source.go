@@ -0,0 +1,250 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"github.com/lrstanley/marill/procfinder"
+)
+
+// DomainSource represents a method of discovering the domains a server is
+// hosting (e.g. a control panel, or the configuration of a webserver).
+type DomainSource interface {
+	// Name is the short name of the source, used to force the source via
+	// Finder.Source.
+	Name() string
+	// Description is a human readable description of the source.
+	Description() string
+	// Detect returns true if the source applies to the server.
+	Detect(f *Finder) bool
+	// Domains returns the domains the source knows of.
+	Domains(f *Finder) ([]*Domain, error)
+}
+
+// sources is the registry of domain sources, in the order they are checked.
+var sources = []DomainSource{
+	&cpanelSource{},
+	&directadminSource{},
+	&pleskSource{},
+	&litespeedSource{},
+	&apacheSource{},
+	&nginxSource{},
+	&dockerSource{},
+}
+
+// RegisterSource adds a custom domain source to the registry. If a source
+// with the same name already exists, it is replaced.
+func RegisterSource(src DomainSource) {
+	for i := range sources {
+		if sources[i].Name() == src.Name() {
+			sources[i] = src
+			return
+		}
+	}
+
+	sources = append(sources, src)
+}
+
+// Sources returns all registered domain sources.
+func Sources() []DomainSource {
+	out := make([]DomainSource, len(sources))
+	copy(out, sources)
+
+	return out
+}
+
+// GetSource returns the registered domain source with the given name, or nil
+// if none exists.
+func GetSource(name string) DomainSource {
+	for _, src := range sources {
+		if src.Name() == name {
+			return src
+		}
+	}
+
+	return nil
+}
+
+// panelProcs are the process names of the control panels we support. the
+// webservers on these servers are managed by the panel, so the panel is
+// used as the source of domains, rather than the webserver itself.
+var panelProcs = [...]string{"cpsrvd", "directadmin", "sw-cp-serverd"}
+
+// hasPanel returns true if any supported control panel is running.
+func (f *Finder) hasPanel() bool {
+	for _, name := range panelProcs {
+		if f.running(name) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// running returns the first process with one of the given names.
+func (f *Finder) running(names ...string) *procfinder.Process {
+	for _, proc := range f.Procs {
+		for _, name := range names {
+			if proc.Name == name {
+				return proc
+			}
+		}
+	}
+
+	return nil
+}
+
+// listening returns the first listening process (webserver or not) with one
+// of the given names.
+func (f *Finder) listening(names ...string) *procfinder.Process {
+	for _, proc := range f.Listening {
+		for _, name := range names {
+			if proc.Name == name {
+				return proc
+			}
+		}
+	}
+
+	return nil
+}
+
+// exe returns the binary of the first matching process, if any.
+func (f *Finder) exe(names ...string) string {
+	if proc := f.running(names...); proc != nil {
+		return proc.Exe
+	}
+
+	return ""
+}
+
+// cpanelSource reads domains from the cPanel userdata domains index.
+type cpanelSource struct{}
+
+func (cpanelSource) Name() string          { return "cpanel" }
+func (cpanelSource) Description() string   { return "cPanel (" + cpanelUserdataDomains + ")" }
+func (cpanelSource) Detect(f *Finder) bool { return f.running("cpsrvd") != nil }
+
+func (cpanelSource) Domains(f *Finder) ([]*Domain, error) {
+	return f.ReadCpanelVars()
+}
+
+// directadminSource reads domains from the DirectAdmin user data.
+type directadminSource struct{}
+
+func (directadminSource) Name() string          { return "directadmin" }
+func (directadminSource) Description() string   { return "DirectAdmin (" + directadminUsers + ")" }
+func (directadminSource) Detect(f *Finder) bool { return f.running("directadmin") != nil }
+
+func (directadminSource) Domains(f *Finder) ([]*Domain, error) {
+	return f.ReadDirectAdminUsers()
+}
+
+// pleskSource reads domains from the Plesk generated vhost configuration.
+type pleskSource struct{}
+
+func (pleskSource) Name() string          { return "plesk" }
+func (pleskSource) Description() string   { return "Plesk (" + pleskVhosts + ")" }
+func (pleskSource) Detect(f *Finder) bool { return f.running("sw-cp-serverd") != nil }
+
+func (pleskSource) Domains(f *Finder) ([]*Domain, error) {
+	return f.ReadPleskVhosts()
+}
+
+// litespeedSource reads domains from the OpenLiteSpeed configuration.
+// LiteSpeed Enterprise uses the Apache configuration, so is handled by
+// apacheSource.
+type litespeedSource struct{}
+
+func (litespeedSource) Name() string        { return "litespeed" }
+func (litespeedSource) Description() string { return "OpenLiteSpeed (conf/httpd_config.conf)" }
+
+func (litespeedSource) Detect(f *Finder) bool {
+	if f.hasPanel() {
+		return false
+	}
+
+	if f.running("openlitespeed") != nil {
+		return true
+	}
+
+	return f.running("lshttpd") != nil && litespeedConfig(f.Root, litespeedServerRoot(f.exe("lshttpd"))) != ""
+}
+
+func (litespeedSource) Domains(f *Finder) ([]*Domain, error) {
+	return f.readLitespeedConfig(litespeedServerRoot(f.exe("openlitespeed", "lshttpd")))
+}
+
+// apacheSource reads domains from Apache (and LiteSpeed Enterprise), via
+// "httpd -S", falling back to parsing the configuration files.
+type apacheSource struct{}
+
+func (apacheSource) Name() string        { return "apache" }
+func (apacheSource) Description() string { return "Apache (httpd -S, or config files)" }
+
+func (apacheSource) Detect(f *Finder) bool {
+	if f.hasPanel() {
+		return false
+	}
+
+	if f.running("httpd", "apache") != nil {
+		return true
+	}
+
+	return f.running("lshttpd") != nil && litespeedConfig(f.Root, litespeedServerRoot(f.exe("lshttpd"))) == ""
+}
+
+func (apacheSource) Domains(f *Finder) ([]*Domain, error) {
+	exe := f.exe("httpd", "apache", "lshttpd")
+
+	if f.ApacheConfig || f.Root != "" {
+		return f.readApacheConfig(exe)
+	}
+
+	domains, err := f.readApacheVhosts(exe)
+	if err == nil {
+		return domains, nil
+	}
+
+	switch err.GetCode() {
+	case ErrApacheFetchVhosts, ErrApacheInvalidVhosts, ErrApacheNoEntries:
+		// "-S" isn't supported, or didn't give us anything useful. fall
+		// back to parsing the configuration files ourselves.
+		f.Log.Printf("unable to use apache -S (%s), falling back to parsing config files", err)
+		return f.readApacheConfig(exe)
+	}
+
+	return nil, err
+}
+
+// nginxSource reads domains from nginx, via "nginx -T", falling back to
+// reading the configuration files.
+type nginxSource struct{}
+
+func (nginxSource) Name() string        { return "nginx" }
+func (nginxSource) Description() string { return "nginx (nginx -T, or config files)" }
+
+func (nginxSource) Detect(f *Finder) bool {
+	return !f.hasPanel() && f.running("nginx") != nil
+}
+
+func (nginxSource) Domains(f *Finder) ([]*Domain, error) {
+	if f.Root != "" {
+		return f.readNginxConfig()
+	}
+
+	domains, err := f.readNginxVhosts(f.exe("nginx"))
+	if err == nil {
+		return domains, nil
+	}
+
+	switch err.GetCode() {
+	case ErrNginxFetchVhosts, ErrNginxInvalidVhosts:
+		// "-T" isn't supported (nginx < 1.9.2). fall back to reading the
+		// configuration files ourselves.
+		f.Log.Printf("unable to use nginx -T (%s), falling back to reading config files", err)
+		return f.readNginxConfig()
+	}
+
+	return nil, err
+}
@@ -0,0 +1,143 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package domfinder
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/lrstanley/marill/procfinder"
+	"github.com/lrstanley/marill/utils"
+)
+
+func TestGetSources(t *testing.T) {
+	proc := func(name string, port int64) *procfinder.Process {
+		return &procfinder.Process{Name: name, Port: port}
+	}
+
+	cases := []struct {
+		name      string
+		procs     []*procfinder.Process
+		listening []*procfinder.Process // non-webserver listening processes
+		source    string
+		want      []string // source names; nil if an error is expected
+		code      int      // error code, if one is expected
+	}{
+		{name: "apache", procs: []*procfinder.Process{proc("httpd", 80)}, want: []string{"apache"}},
+		{name: "nginx", procs: []*procfinder.Process{proc("nginx", 8443)}, want: []string{"nginx"}},
+		{name: "non-standard", procs: []*procfinder.Process{proc("nginx", 80), proc("httpd", 8080)}, want: []string{"apache", "nginx"}},
+		{name: "both", procs: []*procfinder.Process{proc("nginx", 443), proc("httpd", 80)}, want: []string{"apache", "nginx"}},
+		{name: "cpanel", procs: []*procfinder.Process{proc("cpsrvd", 2083), proc("httpd", 80)}, want: []string{"cpanel"}},
+		{name: "plesk", procs: []*procfinder.Process{proc("sw-cp-serverd", 8443), proc("nginx", 80)}, want: []string{"plesk"}},
+		{name: "docker", listening: []*procfinder.Process{proc("docker-proxy", 3306)}, want: []string{"docker"}},
+		{name: "docker-nginx", procs: []*procfinder.Process{proc("nginx", 80)}, listening: []*procfinder.Process{proc("docker-proxy", 6379)}, want: []string{"nginx", "docker"}},
+		{name: "none", procs: nil, code: ErrNoWebservers},
+		{name: "unsupported", procs: []*procfinder.Process{proc("caddy", 80)}, code: ErrNotImplemented},
+		{name: "forced", procs: nil, source: "nginx, cpanel", want: []string{"nginx", "cpanel"}},
+		{name: "unknown", procs: []*procfinder.Process{proc("httpd", 80)}, source: "bogus", code: ErrUnknownSource},
+	}
+
+	for _, c := range cases {
+		// a missing socket, so the docker api of the host running the tests
+		// isn't used.
+		f := &Finder{Procs: c.procs, Listening: append(c.listening, c.procs...), Source: c.source, DockerSocket: "testdata/missing.sock", Log: log.New(ioutil.Discard, "", 0)}
+		f.GetMainWebserver()
+
+		sources, err := f.getSources()
+
+		if c.want == nil {
+			if err == nil {
+				t.Fatalf("getSources(%s) returned no error, wanted code %d", c.name, c.code)
+			}
+
+			if code := err.GetCode(); code != c.code {
+				t.Fatalf("getSources(%s) == %q (code %d), wanted code %d", c.name, err, code, c.code)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("getSources(%s) returned error: %s", c.name, err)
+		}
+
+		var out []string
+		for _, src := range sources {
+			out = append(out, src.Name())
+		}
+
+		if !reflect.DeepEqual(out, c.want) {
+			t.Fatalf("getSources(%s) == %q, wanted %q", c.name, out, c.want)
+		}
+	}
+
+	return
+}
+
+// testSource is a static DomainSource, used to test combining sources.
+type testSource struct {
+	name    string
+	domains []string
+	err     error
+}
+
+func (s *testSource) Name() string          { return s.name }
+func (s *testSource) Description() string   { return "test source" }
+func (s *testSource) Detect(f *Finder) bool { return false }
+
+func (s *testSource) Domains(f *Finder) (domains []*Domain, err error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	for _, name := range s.domains {
+		domains = append(domains, &Domain{IP: "127.0.0.1", Port: "80", URL: utils.MustURL(name, "80")})
+	}
+
+	return domains, nil
+}
+
+func TestGetDomainsSources(t *testing.T) {
+	// restore the registry afterwards, so other tests don't see the test
+	// sources.
+	defer func(orig []DomainSource) { sources = orig }(Sources())
+
+	RegisterSource(&testSource{name: "test-a", domains: []string{"a.example.com", "shared.example.com"}})
+	RegisterSource(&testSource{name: "test-b", domains: []string{"shared.example.com", "b.example.com"}})
+	RegisterSource(&testSource{name: "test-err", err: &NewErr{Code: ErrNotImplemented, value: "test"}})
+
+	f := &Finder{Source: "test-a,test-err,test-b", Log: log.New(ioutil.Discard, "", 0)}
+	if err := f.GetDomains(); err != nil {
+		t.Fatalf("GetDomains() returned error: %s", err)
+	}
+
+	var out []string
+	for _, dom := range f.Domains {
+		out = append(out, dom.URL.String()+" "+dom.Source)
+	}
+
+	want := []string{
+		"http://a.example.com test-a",
+		"http://shared.example.com test-a",
+		"http://b.example.com test-b",
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("GetDomains() == %q, wanted %q", out, want)
+	}
+
+	if want := []string{"test-a", "test-b"}; !reflect.DeepEqual(f.UsedSources, want) {
+		t.Fatalf("GetDomains() used sources %q, wanted %q", f.UsedSources, want)
+	}
+
+	f = &Finder{Source: "test-err", Log: log.New(ioutil.Discard, "", 0)}
+	if err := f.GetDomains(); err == nil || err.GetCode() != ErrNotImplemented {
+		t.Fatalf("GetDomains() == %v, wanted code %d", err, ErrNotImplemented)
+	}
+
+	return
+}
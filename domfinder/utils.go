@@ -5,9 +5,99 @@
 package domfinder
 
 import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
+// execTimeout is how long we wait for a webserver binary to dump its
+// configuration before we kill it.
+const execTimeout = 10 * time.Second
+
+// errExecTimeout is returned by execOutput when the command didn't complete
+// within execTimeout.
+var errExecTimeout = errors.New("timed out during execution")
+
+// execOutput runs the binary with the provided arguments, returning stdout.
+// The process is killed if it runs longer than execTimeout.
+func execOutput(exe string, args ...string) (string, error) {
+	var output []byte
+	var err error
+	done := make(chan bool, 1)
+	cmd := exec.Command(exe, args...)
+
+	go func() {
+		output, err = cmd.Output()
+		done <- true
+	}()
+
+	// timeout if we don't hear back from the binary fast enough.
+	select {
+	case <-time.After(execTimeout):
+		if cmd.Process != nil {
+			_ = cmd.Process.Kill()
+		}
+		return "", errExecTimeout
+	case <-done:
+	}
+
+	return string(output), err
+}
+
+// maxSymlinks is how many symlinks we follow when resolving paths within
+// Finder.Root.
+const maxSymlinks = 10
+
+// path returns the path within Finder.Root.
+func (f *Finder) path(path string) string {
+	return rootPath(f.Root, path)
+}
+
+// rootPath returns path within the filesystem root (see resolveRoot).
+func rootPath(root, path string) string {
+	if root == "" {
+		return path
+	}
+
+	return resolveRoot(root, filepath.Join(root, path))
+}
+
+// resolveRoot resolves any symlinks of the last element of path (which is
+// already within root), against root rather than the running system.
+// snapshots commonly contain absolute symlinks (e.g. nginx's sites-enabled).
+func resolveRoot(root, path string) string {
+	if root == "" {
+		return path
+	}
+
+	for i := 0; i < maxSymlinks; i++ {
+		target, err := os.Readlink(path)
+		if err != nil {
+			break
+		}
+
+		if filepath.IsAbs(target) {
+			path = filepath.Join(root, target)
+		} else {
+			path = filepath.Join(filepath.Dir(path), target)
+		}
+	}
+
+	return path
+}
+
+// trimRoot returns the path as it is on the server, stripping Finder.Root.
+func trimRoot(root, path string) string {
+	if root == "" {
+		return path
+	}
+
+	return "/" + strings.TrimLeft(strings.TrimPrefix(path, root), "/")
+}
+
 // stripDups strips all domains that have the same resulting URL
 func stripDups(domains *[]*Domain) {
 	var tmp []*Domain
@@ -30,6 +120,17 @@ func stripDups(domains *[]*Domain) {
 	return
 }
 
+// isWildcardIP returns true if ip is a wildcard (listening on all addresses),
+// which we request through localIP instead.
+func isWildcardIP(ip string) bool {
+	switch ip {
+	case "", "*", "_default_", "0.0.0.0", "::":
+		return true
+	}
+
+	return false
+}
+
 var predefined = [...]string{
 	"cpanel", "webmail", "mail", "whm", "cpcalendars", "cpcontacts",
 	"_wildcard_",
@@ -59,6 +59,9 @@ const (
 	ErrInstantiateApp
 	ErrBadDomains
 	ErrDomains
+	ErrDomainFilter
+	ErrRequestProfile
+	ErrProxy
 
 	// process fetching
 	ErrProcList
@@ -81,6 +84,9 @@ var errMsg = map[int]string{
 	ErrInstantiateApp: "unable to instantiate app: %s",
 	ErrBadDomains:     "invalid domain manually provided: %s",
 	ErrDomains:        "unable to parse domain list: %s",
+	ErrDomainFilter:   "invalid domain filter: %s",
+	ErrRequestProfile: "invalid request profile: %s",
+	ErrProxy:          "invalid proxy configuration: %s",
 
 	// process fetching
 	ErrProcList: "unable to get process list: %s",
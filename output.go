@@ -13,6 +13,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/lrstanley/marill/scraper"
 	"github.com/lrstanley/marill/utils"
 	"github.com/tdewolff/minify"
 	"github.com/tdewolff/minify/css"
@@ -70,17 +71,78 @@ func (j *JSONOutput) StringPretty() string {
 type JSONTestResult struct {
 	*TestResult
 	Assets      []*JSONTestResource
+	Pages       []*JSONTestPage
+	BrokenLinks []*JSONLink
+	Mixed       *JSONMixedContent
 	ErrorString string // string representation of any errors
 	URLString   string // string representation of the resulting URL.
+	FailedHop   string // "proxy" or "origin", if the request was through a reverse proxy and failed
+	UnicodeURL  string // Unicode form of the resulting URL, for internationalized domains
 }
 
 type JSONTestResource struct {
 	URL           string
+	Kind          string
 	Code          int
 	ContentLength int64
 	Error         string
 	Time          *utils.TimerResult
 	ContentType   string
+	Mixed         string // "active" or "passive", if the asset is mixed content
+}
+
+// JSONTestPage is a smaller representation of a spidered (or sampled) page,
+// and how it scored.
+type JSONTestPage struct {
+	URL    string
+	Code   int
+	Depth  int
+	Source string // "link" (spidered) or "sitemap"
+	Score  float64
+	Error  string
+	Time   *utils.TimerResult
+}
+
+// JSONMixedContent are the urls of the mixed content (http assets on an https
+// page) within a page.
+type JSONMixedContent struct {
+	Active  []string
+	Passive []string
+}
+
+// JSONLink is a broken link within a page.
+type JSONLink struct {
+	Page      string // url of the page the link was found on
+	URL       string
+	Text      string
+	Internal  bool
+	Method    string
+	Code      int
+	Redirects []string
+	Error     string
+}
+
+// jsonBrokenLinks converts the broken links within result to JSONLink's.
+func jsonBrokenLinks(result *scraper.FetchResult) (links []*JSONLink) {
+	for _, link := range result.BrokenLinks() {
+		var errString string
+		if link.Error != nil {
+			errString = link.Error.Error()
+		}
+
+		links = append(links, &JSONLink{
+			Page:      result.Response.URL.String(),
+			URL:       link.URL,
+			Text:      link.Text,
+			Internal:  link.Internal,
+			Method:    link.Method,
+			Code:      link.Code,
+			Redirects: link.Redirects,
+			Error:     errString,
+		})
+	}
+
+	return links
 }
 
 func genJSONOutput(scan *Scan) (*JSONOutput, error) {
@@ -101,23 +163,64 @@ func genJSONOutput(scan *Scan) (*JSONOutput, error) {
 
 				htmlConvertedResults[i].Assets = append(htmlConvertedResults[i].Assets, &JSONTestResource{
 					URL:           htmlConvertedResults[i].Result.Assets[j].URL,
+					Kind:          htmlConvertedResults[i].Result.Assets[j].Kind,
 					Code:          htmlConvertedResults[i].Result.Assets[j].Response.Code,
 					ContentLength: htmlConvertedResults[i].Result.Assets[j].Response.ContentLength,
 					Error:         errString,
 					Time:          htmlConvertedResults[i].Result.Assets[j].Time,
 					ContentType:   htmlConvertedResults[i].Result.Assets[j].Response.Headers.Get("Content-Type"),
+					Mixed:         htmlConvertedResults[i].Result.Assets[j].Mixed,
 				})
 			}
 		}
 
+		mixed := &JSONMixedContent{}
+		for _, asset := range htmlConvertedResults[i].Result.MixedContent(scraper.MixedActive) {
+			mixed.Active = append(mixed.Active, asset.Request.URL.String())
+		}
+		for _, asset := range htmlConvertedResults[i].Result.MixedContent(scraper.MixedPassive) {
+			mixed.Passive = append(mixed.Passive, asset.Request.URL.String())
+		}
+		if len(mixed.Active) > 0 || len(mixed.Passive) > 0 {
+			htmlConvertedResults[i].Mixed = mixed
+		}
+
+		htmlConvertedResults[i].BrokenLinks = jsonBrokenLinks(htmlConvertedResults[i].Result)
+		for _, page := range htmlConvertedResults[i].TestResult.Pages {
+			htmlConvertedResults[i].BrokenLinks = append(htmlConvertedResults[i].BrokenLinks, jsonBrokenLinks(page.Result)...)
+		}
+
+		for _, page := range htmlConvertedResults[i].TestResult.Pages {
+			var errString string
+			if page.Result.Error != nil {
+				errString = page.Result.Error.Error()
+			}
+
+			htmlConvertedResults[i].Pages = append(htmlConvertedResults[i].Pages, &JSONTestPage{
+				URL:    page.Result.URL,
+				Code:   page.Result.Response.Code,
+				Depth:  page.Result.Depth,
+				Source: page.Result.Source,
+				Score:  page.Score,
+				Error:  errString,
+				Time:   page.Result.Time,
+			})
+		}
+
 		if htmlConvertedResults[i].Result.Error != nil {
 			htmlConvertedResults[i].ErrorString = htmlConvertedResults[i].Result.Error.Error()
 			// make it so errors are still true, but it doesn't bloat the json
 			htmlConvertedResults[i].Result.Error = errors.New(htmlConvertedResults[i].ErrorString)
 		}
 
+		htmlConvertedResults[i].FailedHop = htmlConvertedResults[i].Result.FailedHop()
+		if origin := htmlConvertedResults[i].Result.Origin; origin != nil && origin.Error != nil {
+			origin.Error = errors.New(origin.Error.Error())
+		}
+
 		if htmlConvertedResults[i].Result.Response.URL != nil {
 			htmlConvertedResults[i].URLString = htmlConvertedResults[i].Result.Response.URL.String()
+			htmlConvertedResults[i].UnicodeURL = utils.UnicodeURL(htmlConvertedResults[i].Result.Response.URL)
 		}
 
 		// trim out some of the bulk here
@@ -5,6 +5,7 @@
 package procfinder
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -16,27 +17,32 @@ import (
 	"strings"
 )
 
-func readNetTCP() ([]string, error) {
-	procTCP, err := ioutil.ReadFile("/proc/net/tcp")
+// stateListen is the socket state (within /proc/net/tcp) of listening sockets.
+const stateListen = "0A"
+
+func readNetTCP(root string) ([]string, error) {
+	procTCP, err := ioutil.ReadFile(filepath.Join(root, "/proc/net/tcp"))
 	if err != nil {
 		return nil, err
 	}
 
-	lines := strings.Split(strings.Trim(string(procTCP), "\n"), "\n")
+	// strip the header line from each file.
+	lines := strings.Split(strings.Trim(string(procTCP), "\n"), "\n")[1:]
 
-	procTCP6, err := ioutil.ReadFile("/proc/net/tcp6")
+	procTCP6, err := ioutil.ReadFile(filepath.Join(root, "/proc/net/tcp6"))
 	// don't panic if we can't pull tcp6 data.
 	if err == nil {
-		lines = append(lines, strings.Split(strings.Trim(string(procTCP6), "\n"), "\n")...)
+		lines = append(lines, strings.Split(strings.Trim(string(procTCP6), "\n"), "\n")[1:]...)
 	}
 
-	return lines[1 : len(lines)-1], nil
+	return lines, nil
 }
 
 // Process represents a unix based process. This provides the direct path to the exe that
 // it was originally spawned with, along with the nicename and process ID.
 type Process struct {
 	PID         string
+	PPID        string
 	Name        string
 	Exe         string
 	User        string
@@ -44,6 +50,7 @@ type Process struct {
 	Port        int64
 	ForeignIP   string
 	ForeignPort int64
+	Listening   bool // if the socket is listening for connections (rather than connected)
 }
 
 func removeEmpty(array []string) []string {
@@ -69,15 +76,27 @@ func hexToDec(h string) int64 {
 	return d
 }
 
-// convert the ipv4 to decimal. would need to rearrange the ip because the default value
-// is in little Endian order.
+// convert the ipv4/ipv6 address to its string form. would need to rearrange the ip
+// because the default value is in little Endian order (per 32 bit word, for ipv6).
 func ip(ip string) string {
 	var out string
 
-	// check ip size. if greater than 8, it is ipv6
-	if len(ip) > 8 && len(ip) <= 32 {
-		i := []string{ip[30:32], ip[28:30], ip[26:28], ip[24:26], ip[22:24], ip[20:22], ip[18:20], ip[16:18], ip[14:16], ip[12:14], ip[10:12], ip[8:10], ip[6:8], ip[4:6], ip[2:4], ip[0:2]}
-		out = fmt.Sprintf("%v%v:%v%v:%v%v:%v%v:%v%v:%v%v:%v%v:%v%v", i[14], i[15], i[13], i[12], i[10], i[11], i[8], i[9], i[6], i[7], i[4], i[5], i[2], i[3], i[0], i[1])
+	// check ip size. if it's 32 characters, it is ipv6
+	if len(ip) == 32 {
+		raw, err := hex.DecodeString(ip)
+		if err != nil {
+			return "0.0.0.0"
+		}
+
+		addr := make(net.IP, net.IPv6len)
+		for word := 0; word < 4; word++ {
+			for b := 0; b < 4; b++ {
+				addr[word*4+b] = raw[word*4+3-b]
+			}
+		}
+
+		// this also converts ipv4-mapped addresses (::ffff:1.2.3.4) to ipv4.
+		out = addr.String()
 	} else if len(ip) <= 8 && len(ip) > 0 {
 		// ipv4
 		i := []int64{hexToDec(ip[6:8]), hexToDec(ip[4:6]), hexToDec(ip[2:4]), hexToDec(ip[0:2])}
@@ -91,8 +110,8 @@ func ip(ip string) string {
 }
 
 // loop through all fd dirs of process on /proc to compare the inode and get the pid
-func getPid(inode string) (pid string) {
-	d, err := filepath.Glob("/proc/[0-9]*/fd/[0-9]*")
+func getPid(root, inode string) (pid string) {
+	d, err := filepath.Glob(filepath.Join(root, "/proc/[0-9]*/fd/[0-9]*"))
 	if err != nil {
 		return pid
 	}
@@ -100,25 +119,25 @@ func getPid(inode string) (pid string) {
 	for _, item := range d {
 		path, _ := os.Readlink(item)
 		if strings.Contains(path, inode) {
-			pid = strings.Split(item, "/")[2]
+			pid = filepath.Base(filepath.Dir(filepath.Dir(item)))
 		}
 	}
 
 	return pid
 }
 
-func getProcessExe(pid string) string {
-	exe := fmt.Sprintf("/proc/%s/exe", pid)
+func getProcessExe(root, pid string) string {
+	exe := filepath.Join(root, fmt.Sprintf("/proc/%s/exe", pid))
 	path, _ := os.Readlink(exe)
 	return path
 }
 
-func getProcessName(pid string) (name string) {
-	tmp, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/comm", pid))
+func getProcessName(root, pid string) (name string) {
+	tmp, err := ioutil.ReadFile(filepath.Join(root, fmt.Sprintf("/proc/%s/comm", pid)))
 
 	if err != nil {
 		// "comm" likely doesn't exist. Try "/proc/PID/exe" and read the link.
-		link, err := os.Readlink(fmt.Sprintf("/proc/%s/exe", pid))
+		link, err := os.Readlink(filepath.Join(root, fmt.Sprintf("/proc/%s/exe", pid)))
 		if err != nil {
 			return ""
 		}
@@ -129,14 +148,58 @@ func getProcessName(pid string) (name string) {
 	return strings.Split(string(tmp), "\n")[0]
 }
 
-func getUser(uid string) string {
-	u, _ := user.LookupId(uid)
+// getParentPid returns the parent process ID of pid, from /proc/<pid>/status.
+func getParentPid(root, pid string) string {
+	status, err := ioutil.ReadFile(filepath.Join(root, fmt.Sprintf("/proc/%s/status", pid)))
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "PPid:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "PPid:"))
+		}
+	}
+
+	return ""
+}
+
+func getUser(root, uid string) string {
+	if root != "" {
+		return lookupPasswd(filepath.Join(root, "/etc/passwd"), uid)
+	}
+
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return uid
+	}
+
 	return u.Username
 }
 
-// GetProcs crawls /proc/ for all pids that have bound ports
-func GetProcs() (pl []*Process, err error) {
-	tcp, err := readNetTCP()
+// lookupPasswd returns the username of uid from a passwd file, or the uid
+// itself if it can't be found.
+func lookupPasswd(path, uid string) string {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return uid
+	}
+
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) > 2 && fields[2] == uid {
+			return fields[0]
+		}
+	}
+
+	return uid
+}
+
+// GetProcs crawls /proc/ for all pids that have bound ports. root is the
+// filesystem root which /proc (and /etc/passwd) is read from (e.g. a
+// captured snapshot of a server), or "" for the running system.
+func GetProcs(root string) (pl []*Process, err error) {
+	tcp, err := readNetTCP(root)
 
 	if err != nil {
 		return nil, err
@@ -144,6 +207,10 @@ func GetProcs() (pl []*Process, err error) {
 
 	for _, line := range tcp {
 		lineArray := removeEmpty(strings.Split(strings.TrimSpace(line), " "))
+		if len(lineArray) < 10 {
+			continue
+		}
+
 		ipaddr, port, err := net.SplitHostPort(lineArray[1])
 		if err != nil {
 			continue
@@ -159,12 +226,14 @@ func GetProcs() (pl []*Process, err error) {
 			Port:        hexToDec(port),
 			ForeignIP:   ip(fipaddr),
 			ForeignPort: hexToDec(fport),
-			User:        getUser(lineArray[7]),
-			PID:         getPid(lineArray[9]),
+			User:        getUser(root, lineArray[7]),
+			PID:         getPid(root, lineArray[9]),
+			Listening:   lineArray[3] == stateListen,
 		}
 
-		proc.Exe = getProcessExe(proc.PID)
-		proc.Name = getProcessName(proc.PID)
+		proc.PPID = getParentPid(root, proc.PID)
+		proc.Exe = getProcessExe(root, proc.PID)
+		proc.Name = getProcessName(root, proc.PID)
 
 		pl = append(pl, proc)
 	}
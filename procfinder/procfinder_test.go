@@ -5,6 +5,7 @@
 package procfinder
 
 import (
+	"fmt"
 	"os"
 	"reflect"
 	"strconv"
@@ -67,6 +68,10 @@ func TestIP(t *testing.T) {
 		{in: "8706140A", want: "10.20.6.135"},
 		{in: "069AA1C0", want: "192.161.154.6"},
 		{in: "A0AB3448", want: "72.52.171.160"},
+		{in: "00000000000000000000000001000000", want: "::1"},
+		{in: "00000000000000000000000000000000", want: "::"},
+		{in: "B80D0120000000000000000001000000", want: "2001:db8::1"},
+		{in: "0000000000000000FFFF00000100007F", want: "127.0.0.1"},
 		{in: "111111111111111111111111111111111111", want: "0.0.0.0"}, // should fail
 		{in: "", want: "0.0.0.0"},                                     // should fail
 	}
@@ -84,7 +89,7 @@ func TestIP(t *testing.T) {
 
 func TestGetProcessExe(t *testing.T) {
 	pid := strconv.Itoa(os.Getppid())
-	out := getProcessExe(pid)
+	out := getProcessExe("", pid)
 
 	if !strings.HasSuffix(out, "/go") {
 		t.Fatalf("getProcessExe(%q) == %q, not go", pid, out)
@@ -95,7 +100,7 @@ func TestGetProcessExe(t *testing.T) {
 
 func TestGetProcessName(t *testing.T) {
 	pid := strconv.Itoa(os.Getppid())
-	out := getProcessName(pid)
+	out := getProcessName("", pid)
 
 	if out != "go" {
 		t.Fatalf("getProcessName(%q) == %q, not go", pid, out)
@@ -103,3 +108,32 @@ func TestGetProcessName(t *testing.T) {
 
 	return
 }
+
+func TestGetProcs(t *testing.T) {
+	procs, err := GetProcs("testdata/root")
+	if err != nil {
+		t.Fatalf("GetProcs() returned error: %s", err)
+	}
+
+	var out []string
+	for _, proc := range procs {
+		out = append(out, fmt.Sprintf("%s/%s %s %s %s %s:%d %t", proc.PID, proc.PPID, proc.Name, proc.Exe, proc.User, proc.IP, proc.Port, proc.Listening))
+	}
+
+	want := []string{
+		"100/1 httpd /usr/sbin/httpd root 0.0.0.0:80 true",
+		"100/1 httpd /usr/sbin/httpd root 10.0.0.5:443 true",
+		"200/1 mysqld /usr/sbin/mysqld mysql 127.0.0.1:3306 true",
+		"100/1 httpd /usr/sbin/httpd root 10.0.0.5:443 false",
+	}
+
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("GetProcs() == %q, wanted %q", out, want)
+	}
+
+	if _, err = GetProcs("testdata/does-not-exist"); err == nil {
+		t.Fatal("GetProcs() with missing root returned no error")
+	}
+
+	return
+}
@@ -0,0 +1,140 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Kinds of assets, as stored in Resource.Kind.
+const (
+	AssetScript = "script"
+	AssetStyle  = "style"
+	AssetImage  = "image"
+	AssetFont   = "font"
+	AssetMedia  = "media"
+	AssetFrame  = "frame"
+	AssetOther  = "other"
+)
+
+// maxStyleDepth is how many levels of stylesheets are followed (e.g. a
+// stylesheet which @import's another stylesheet, which uses a font) when
+// fetching assets.
+const maxStyleDepth = 3
+
+// maxStyleSize is the max number of bytes read from a stylesheet.
+const maxStyleSize = 2 << 20
+
+// extKinds maps file extensions to the kind of asset they usually are.
+var extKinds = map[string]string{
+	".js": AssetScript, ".mjs": AssetScript,
+	".css": AssetStyle,
+	".png": AssetImage, ".jpg": AssetImage, ".jpeg": AssetImage, ".gif": AssetImage, ".svg": AssetImage,
+	".webp": AssetImage, ".avif": AssetImage, ".ico": AssetImage, ".bmp": AssetImage, ".cur": AssetImage,
+	".woff": AssetFont, ".woff2": AssetFont, ".ttf": AssetFont, ".otf": AssetFont, ".eot": AssetFont,
+	".mp4": AssetMedia, ".webm": AssetMedia, ".ogg": AssetMedia, ".ogv": AssetMedia, ".mp3": AssetMedia,
+	".wav": AssetMedia, ".m4a": AssetMedia, ".vtt": AssetMedia,
+}
+
+// assetKind guesses the kind of asset a url references, based on its file
+// extension.
+func assetKind(uri string) string {
+	if i := strings.IndexAny(uri, "?#"); i > -1 {
+		uri = uri[:i]
+	}
+
+	if kind, ok := extKinds[strings.ToLower(path.Ext(uri))]; ok {
+		return kind
+	}
+
+	return AssetOther
+}
+
+var (
+	// reNonFetchable matches urls which reference something other than a
+	// remote resource (e.g. inline data).
+	reNonFetchable = regexp.MustCompile(`(?i)^\s*(data|blob|about|javascript|mailto|tel):`)
+
+	reCSSComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	reCSSImport  = regexp.MustCompile(`(?i)@import\s+(?:url\(\s*)?(?:"([^"]*)"|'([^']*)'|([^\s'");]+))`)
+	reCSSURL     = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^\s'")]*))\s*\)`)
+	reFontFace   = regexp.MustCompile(`(?is)@font-face\s*\{[^}]*\}`)
+)
+
+// resolveCSSURL resolves a url within a stylesheet against the url of the
+// stylesheet (which, unlike fmtTagLinks, means "../fonts/x.woff" is relative
+// to the directory of the stylesheet).
+func resolveCSSURL(ref string, parent *url.URL) string {
+	ref = strings.TrimSpace(ref)
+	if len(ref) == 0 || strings.HasPrefix(ref, "#") || reNonFetchable.MatchString(ref) {
+		return ""
+	}
+
+	uri, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+
+	uri = parent.ResolveReference(uri)
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return ""
+	}
+	uri.Fragment = ""
+
+	return uri.String()
+}
+
+// cssMatch returns the url within a reCSSImport/reCSSURL submatch, which is
+// either double quoted, single quoted, or not quoted.
+func cssMatch(match []string) string {
+	for _, group := range match[1:] {
+		if len(group) > 0 {
+			return group
+		}
+	}
+
+	return ""
+}
+
+// getCSSSrc yields all assets referenced within a stylesheet (or inline
+// style): @import'd stylesheets, fonts within @font-face rules, and
+// anything else within url() (usually images).
+func getCSSSrc(css string, parent *url.URL) (assets []*assetLink) {
+	css = reCSSComment.ReplaceAllString(css, "")
+
+	seen := make(map[string]bool)
+	add := func(ref, kind string) {
+		if src := resolveCSSURL(ref, parent); len(src) > 0 && !seen[src] {
+			seen[src] = true
+			assets = append(assets, &assetLink{URL: src, Kind: kind})
+		}
+	}
+
+	for _, match := range reCSSImport.FindAllStringSubmatch(css, -1) {
+		add(cssMatch(match), AssetStyle)
+	}
+	css = reCSSImport.ReplaceAllString(css, "")
+
+	for _, rule := range reFontFace.FindAllString(css, -1) {
+		for _, match := range reCSSURL.FindAllStringSubmatch(rule, -1) {
+			add(cssMatch(match), AssetFont)
+		}
+	}
+	css = reFontFace.ReplaceAllString(css, "")
+
+	for _, match := range reCSSURL.FindAllStringSubmatch(css, -1) {
+		kind := assetKind(cssMatch(match))
+		if kind == AssetOther {
+			kind = AssetImage
+		}
+
+		add(cssMatch(match), kind)
+	}
+
+	return assets
+}
@@ -0,0 +1,77 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+func TestAssetKind(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"http://example.com/app.js", AssetScript},
+		{"http://example.com/app.min.js?v=2", AssetScript},
+		{"http://example.com/main.CSS", AssetStyle},
+		{"http://example.com/logo.svg#icon", AssetImage},
+		{"http://example.com/font.woff2", AssetFont},
+		{"http://example.com/intro.mp4", AssetMedia},
+		{"http://example.com/", AssetOther},
+		{"http://example.com/api?format=.js", AssetOther},
+	}
+
+	for _, c := range cases {
+		if out := assetKind(c.in); out != c.want {
+			t.Fatalf("assetKind(%q) == %q, wanted %q", c.in, out, c.want)
+		}
+	}
+
+	return
+}
+
+func TestGetCSSSrc(t *testing.T) {
+	css := `@charset "utf-8";
+@import "reset.css";
+@import url('../print.css') print;
+@import url(https://fonts.example.net/css?family=Open+Sans);
+/* background: url(/commented.png); */
+@font-face {
+	font-family: "Icons";
+	src: url("../fonts/icons.eot?#iefix") format("embedded-opentype"),
+	     url(../fonts/icons.woff) format("woff"),
+	     url(data:font/woff2;base64,d09GMgABAAAAA) format("woff2");
+}
+body { background: #fff url( "../img/bg.png" ) no-repeat; }
+.logo { background-image: url(/img/logo.svg#mark), url(//cdn.example.com/sprite); }
+.filter { filter: url(#blur); cursor: url(cursor.cur), auto; }
+.dup { background: url(../img/bg.png); }`
+
+	want := []string{
+		"style http://example.com/css/reset.css",
+		"style http://example.com/print.css",
+		"style https://fonts.example.net/css?family=Open+Sans",
+		"font http://example.com/fonts/icons.eot?",
+		"font http://example.com/fonts/icons.woff",
+		"image http://example.com/img/bg.png",
+		"image http://example.com/img/logo.svg",
+		"image http://cdn.example.com/sprite",
+		"image http://example.com/css/cursor.cur",
+	}
+
+	var out []string
+	for _, asset := range getCSSSrc(css, utils.MustURL("http://example.com/css/main.css", "")) {
+		out = append(out, asset.Kind+" "+asset.URL)
+	}
+
+	if strings.Join(out, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("getCSSSrc() == %q, wanted %q", out, want)
+	}
+
+	return
+}
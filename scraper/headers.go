@@ -0,0 +1,172 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SecurityHeaders are the parsed security related headers of a response.
+type SecurityHeaders struct {
+	HSTS               *HSTS     // HSTS is the Strict-Transport-Security policy, if any
+	CSP                *CSP      // CSP is the (enforced) Content-Security-Policy, if any
+	FrameOptions       string    // FrameOptions is the X-Frame-Options value, uppercased (e.g. "DENY"), if any
+	ContentTypeOptions string    // ContentTypeOptions is the X-Content-Type-Options value, lowercased (e.g. "nosniff"), if any
+	ReferrerPolicy     string    // ReferrerPolicy is the Referrer-Policy value, lowercased (e.g. "same-origin"), if any
+	Cookies            []*Cookie // Cookies are the cookies set by the response
+}
+
+// HSTS is a Strict-Transport-Security policy.
+type HSTS struct {
+	MaxAge            int64 // MaxAge is how many seconds the policy applies for
+	IncludeSubDomains bool  // IncludeSubDomains is true if the policy applies to all subdomains
+	Preload           bool  // Preload is true if the site has opted into browser preload lists
+}
+
+// String returns the policy in a normalized form, e.g.
+// "max-age=31536000; includesubdomains".
+func (h *HSTS) String() string {
+	policy := "max-age=" + strconv.FormatInt(h.MaxAge, 10)
+
+	if h.IncludeSubDomains {
+		policy += "; includesubdomains"
+	}
+
+	if h.Preload {
+		policy += "; preload"
+	}
+
+	return policy
+}
+
+// CSP is a Content-Security-Policy.
+type CSP struct {
+	Directives map[string][]string // Directives maps each (lowercased) directive to its sources
+}
+
+// fetchDirectives are the directives which fall back to default-src when
+// they aren't set.
+var fetchDirectives = map[string]bool{
+	"script-src": true, "style-src": true, "img-src": true, "font-src": true, "connect-src": true,
+	"media-src": true, "object-src": true, "frame-src": true, "child-src": true, "worker-src": true,
+	"manifest-src": true,
+}
+
+// Sources returns the sources allowed by directive, falling back to
+// default-src for fetch directives (e.g. script-src).
+func (c *CSP) Sources(directive string) []string {
+	if sources, ok := c.Directives[directive]; ok {
+		return sources
+	}
+
+	if fetchDirectives[directive] {
+		return c.Directives["default-src"]
+	}
+
+	return nil
+}
+
+// Cookie is a cookie set by a response, and the flags it was set with.
+type Cookie struct {
+	Name     string // Name is the name of the cookie
+	Secure   bool   // Secure is true if the cookie is only sent over https
+	HttpOnly bool   // HttpOnly is true if the cookie isn't accessible from javascript
+	SameSite string // SameSite is "strict", "lax" or "none", or empty if it wasn't set
+}
+
+// Security returns the parsed security related headers of the response.
+func (r *Response) Security() *SecurityHeaders {
+	return parseSecurityHeaders(r.Headers)
+}
+
+// parseSecurityHeaders parses the security related headers within headers.
+func parseSecurityHeaders(headers http.Header) *SecurityHeaders {
+	sec := &SecurityHeaders{
+		FrameOptions:       strings.ToUpper(strings.TrimSpace(headers.Get("X-Frame-Options"))),
+		ContentTypeOptions: strings.ToLower(strings.TrimSpace(headers.Get("X-Content-Type-Options"))),
+	}
+
+	if policy := headers.Get("Strict-Transport-Security"); policy != "" {
+		sec.HSTS = parseHSTS(policy)
+	}
+
+	if policies := headers["Content-Security-Policy"]; len(policies) > 0 {
+		sec.CSP = parseCSP(policies)
+	}
+
+	// Referrer-Policy may list fallbacks for older browsers, of which the
+	// last one that is supported is used.
+	if policy := headers.Get("Referrer-Policy"); policy != "" {
+		policies := strings.Split(policy, ",")
+		sec.ReferrerPolicy = strings.ToLower(strings.TrimSpace(policies[len(policies)-1]))
+	}
+
+	for _, cookie := range (&http.Response{Header: headers}).Cookies() {
+		c := &Cookie{Name: cookie.Name, Secure: cookie.Secure, HttpOnly: cookie.HttpOnly}
+
+		switch cookie.SameSite {
+		case http.SameSiteStrictMode:
+			c.SameSite = "strict"
+		case http.SameSiteLaxMode:
+			c.SameSite = "lax"
+		case http.SameSiteNoneMode:
+			c.SameSite = "none"
+		}
+
+		sec.Cookies = append(sec.Cookies, c)
+	}
+
+	return sec
+}
+
+// parseHSTS parses a Strict-Transport-Security header. An invalid max-age
+// is treated as 0 (which disables the policy).
+func parseHSTS(policy string) *HSTS {
+	hsts := &HSTS{}
+
+	for _, directive := range strings.Split(policy, ";") {
+		name, value := directive, ""
+		if i := strings.Index(directive, "="); i > -1 {
+			name, value = directive[:i], directive[i+1:]
+		}
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "max-age":
+			hsts.MaxAge, _ = strconv.ParseInt(strings.Trim(strings.TrimSpace(value), `"`), 10, 64)
+		case "includesubdomains":
+			hsts.IncludeSubDomains = true
+		case "preload":
+			hsts.Preload = true
+		}
+	}
+
+	return hsts
+}
+
+// parseCSP parses one or more Content-Security-Policy headers. If a directive
+// is set more than once, the first one is used.
+func parseCSP(policies []string) *CSP {
+	csp := &CSP{Directives: make(map[string][]string)}
+
+	for _, policy := range policies {
+		for _, directive := range strings.Split(policy, ";") {
+			fields := strings.Fields(directive)
+			if len(fields) == 0 {
+				continue
+			}
+
+			name := strings.ToLower(fields[0])
+			if _, ok := csp.Directives[name]; ok {
+				continue
+			}
+
+			csp.Directives[name] = fields[1:]
+		}
+	}
+
+	return csp
+}
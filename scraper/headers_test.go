@@ -0,0 +1,85 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseSecurityHeaders(t *testing.T) {
+	cases := []struct {
+		in      http.Header
+		hsts    string // wanted HSTS.String(), or "" if nil
+		scripts string // wanted CSP.Sources("script-src"), or "" if no policy
+		frame   string
+		nosniff string
+		referer string
+		cookies string // wanted "name:secure,httponly,samesite" of each cookie
+	}{
+		{in: http.Header{}},
+		{
+			in: http.Header{
+				"Strict-Transport-Security": {`max-age="31536000"; includeSubDomains; preload`},
+				"Content-Security-Policy":   {"default-src 'self'; img-src *", "script-src https://cdn.example.com; img-src 'none'"},
+				"X-Frame-Options":           {"sameorigin"},
+				"X-Content-Type-Options":    {"NoSniff"},
+				"Referrer-Policy":           {"no-referrer, Strict-Origin-When-Cross-Origin"},
+				"Set-Cookie": {
+					"session=abc; Path=/; Secure; HttpOnly; SameSite=Lax",
+					"prefs=def; SameSite=None",
+					"tracking=ghi",
+				},
+			},
+			hsts:    "max-age=31536000; includesubdomains; preload",
+			scripts: "https://cdn.example.com",
+			frame:   "SAMEORIGIN",
+			nosniff: "nosniff",
+			referer: "strict-origin-when-cross-origin",
+			cookies: "session:true,true,lax prefs:false,false,none tracking:false,false,",
+		},
+		{
+			in: http.Header{
+				"Strict-Transport-Security": {"max-age=invalid"},
+				"Content-Security-Policy":   {"script-src 'self' 'unsafe-inline'; Default-Src 'none'"},
+			},
+			hsts:    "max-age=0",
+			scripts: "'self' 'unsafe-inline'",
+		},
+	}
+
+	for _, c := range cases {
+		sec := parseSecurityHeaders(c.in)
+
+		var hsts, scripts string
+		if sec.HSTS != nil {
+			hsts = sec.HSTS.String()
+		}
+		if sec.CSP != nil {
+			scripts = strings.Join(sec.CSP.Sources("script-src"), " ")
+		}
+
+		var cookies []string
+		for _, cookie := range sec.Cookies {
+			cookies = append(cookies, fmt.Sprintf("%s:%t,%t,%s", cookie.Name, cookie.Secure, cookie.HttpOnly, cookie.SameSite))
+		}
+
+		if hsts != c.hsts || scripts != c.scripts {
+			t.Fatalf("parseSecurityHeaders(%v) == (hsts: %q, script-src: %q), wanted (%q, %q)", c.in, hsts, scripts, c.hsts, c.scripts)
+		}
+
+		if sec.FrameOptions != c.frame || sec.ContentTypeOptions != c.nosniff || sec.ReferrerPolicy != c.referer {
+			t.Fatalf("parseSecurityHeaders(%v) == (frame: %q, nosniff: %q, referrer: %q), wanted (%q, %q, %q)", c.in, sec.FrameOptions, sec.ContentTypeOptions, sec.ReferrerPolicy, c.frame, c.nosniff, c.referer)
+		}
+
+		if out := strings.Join(cookies, " "); out != c.cookies {
+			t.Fatalf("parseSecurityHeaders(%v).Cookies == %q, wanted %q", c.in, out, c.cookies)
+		}
+	}
+
+	return
+}
@@ -26,13 +26,103 @@ func getAttr(attr string, attrs []html.Attribute) (val string) {
 	return
 }
 
-// getSrc crawls the body of the Results page, yielding all img/script/link resources
-// so they can later be fetched.
-func getSrc(b io.Reader, parent *url.URL) (urls []string) {
-	urls = []string{}
+// assetLink is a link to an asset within a page (or stylesheet), along with
+// what kind of asset it is (see AssetScript, AssetStyle, etc).
+type assetLink struct {
+	URL  string
+	Kind string
+}
+
+// preloadKinds maps the "as" attribute of <link rel="preload"> to the kind
+// of asset being preloaded.
+var preloadKinds = map[string]string{
+	"script":   AssetScript,
+	"style":    AssetStyle,
+	"image":    AssetImage,
+	"font":     AssetFont,
+	"audio":    AssetMedia,
+	"video":    AssetMedia,
+	"track":    AssetMedia,
+	"document": AssetFrame,
+}
+
+// linkKind returns the kind of asset a <link> tag references, based on its
+// rel (and as) attributes. An empty string is returned if the link isn't
+// an asset (e.g. rel="canonical").
+func linkKind(rel, as, href string) string {
+	if len(strings.TrimSpace(rel)) == 0 {
+		return assetKind(href)
+	}
+
+	for _, rel := range strings.Fields(strings.ToLower(rel)) {
+		switch rel {
+		case "stylesheet":
+			return AssetStyle
+		case "icon", "apple-touch-icon", "apple-touch-icon-precomposed", "mask-icon":
+			return AssetImage
+		case "modulepreload":
+			return AssetScript
+		case "manifest":
+			return AssetOther
+		case "preload", "prefetch":
+			if kind, ok := preloadKinds[strings.ToLower(as)]; ok {
+				return kind
+			}
+
+			return assetKind(href)
+		}
+	}
+
+	return ""
+}
+
+// parseSrcset returns the urls within a srcset attribute, e.g.
+// "img-1x.png 1x, img-2x.png 2x".
+func parseSrcset(srcset string) (urls []string) {
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+
+	return urls
+}
+
+// getSrc crawls the body of the Results page, yielding all assets (scripts,
+// stylesheets, images, fonts, media, frames, etc) so they can later be
+// fetched. This includes those within srcset attributes, and url()'s within
+// inline styles and <style> tags.
+func getSrc(b io.Reader, parent *url.URL) (assets []*assetLink) {
+	seen := make(map[string]bool)
+	add := func(src, kind string) {
+		if reNonFetchable.MatchString(src) {
+			return
+		}
+
+		if src = fmtTagLinks(strings.TrimSpace(src), parent); len(src) == 0 || seen[src] {
+			return
+		}
+		seen[src] = true
+
+		assets = append(assets, &assetLink{URL: src, Kind: kind})
+	}
+	addCSS := func(css string) {
+		for _, asset := range getCSSSrc(css, parent) {
+			if !seen[asset.URL] {
+				seen[asset.URL] = true
+				assets = append(assets, asset)
+			}
+		}
+	}
 
 	z := html.NewTokenizer(b)
 
+	// mediaKind is the kind of asset <source> tags reference, based on
+	// the tag they're within (<picture>, <video> or <audio>), and inStyle
+	// is true when within a <style> tag.
+	var mediaKind string
+	var inStyle bool
+
 	for {
 		// loop through all tokens in the html body response
 		tt := z.Next()
@@ -40,39 +130,64 @@ func getSrc(b io.Reader, parent *url.URL) (urls []string) {
 		switch {
 		case tt == html.ErrorToken:
 			// this assumes that there are no further tokens -- end of document
-
-			stripURLDups(&urls)
-
 			return
+		case tt == html.TextToken && inStyle:
+			addCSS(string(z.Text()))
+		case tt == html.EndTagToken:
+			t := z.Token()
+
+			switch t.Data {
+			case "picture", "video", "audio":
+				mediaKind = ""
+			case "style":
+				inStyle = false
+			}
 		case tt == html.StartTagToken || tt == html.SelfClosingTagToken:
 			t := z.Token()
 
-			var src string
+			if style := getAttr("style", t.Attr); len(style) > 0 {
+				addCSS(style)
+			}
 
 			switch t.Data {
 			case "link":
-				src = getAttr("href", t.Attr)
-
-				rel := getAttr("rel", t.Attr)
+				src := getAttr("href", t.Attr)
 
-				if len(rel) > 0 && strings.ToLower(rel) != "stylesheet" && strings.ToLower(rel) != "shortcut icon" {
-					continue
+				if kind := linkKind(getAttr("rel", t.Attr), getAttr("as", t.Attr), src); kind != "" {
+					add(src, kind)
 				}
 			case "script":
-				src = getAttr("src", t.Attr)
+				add(getAttr("src", t.Attr), AssetScript)
 			case "img":
-				src = getAttr("src", t.Attr)
-			default:
-				continue
-			}
+				add(getAttr("src", t.Attr), AssetImage)
 
-			src = fmtTagLinks(src, parent)
+				for _, src := range parseSrcset(getAttr("srcset", t.Attr)) {
+					add(src, AssetImage)
+				}
+			case "picture":
+				mediaKind = AssetImage
+			case "video", "audio":
+				mediaKind = AssetMedia
+				add(getAttr("src", t.Attr), AssetMedia)
+				add(getAttr("poster", t.Attr), AssetImage)
+			case "source":
+				kind := mediaKind
+				if len(kind) == 0 {
+					kind = AssetMedia
+				}
 
-			if len(src) == 0 {
-				continue
-			}
+				add(getAttr("src", t.Attr), kind)
 
-			urls = append(urls, src)
+				for _, src := range parseSrcset(getAttr("srcset", t.Attr)) {
+					add(src, kind)
+				}
+			case "track":
+				add(getAttr("src", t.Attr), AssetMedia)
+			case "iframe", "frame":
+				add(getAttr("src", t.Attr), AssetFrame)
+			case "style":
+				inStyle = tt == html.StartTagToken
+			}
 		}
 	}
 }
@@ -144,24 +259,108 @@ func fmtTagLinks(src string, parent *url.URL) string {
 	return src
 }
 
-// stripURLDups strips all duplicate src URLs
-func stripURLDups(domains *[]string) {
-	var tmp []string
+// anchor is an <a href> link within a page.
+type anchor struct {
+	URL      string
+	Text     string // text within the anchor (or the alt text of an image within it)
+	NoFollow bool   // rel="nofollow"
+}
 
-	for _, dom := range *domains {
-		isIn := false
-		for _, other := range tmp {
-			if dom == other {
-				isIn = true
-				break
+// getAnchors crawls the body of a page, yielding all http based <a href>
+// links, along with their text. Links are resolved against the page they were
+// found on, fragments are stripped, and only the first of each url is kept.
+func getAnchors(b io.Reader, parent *url.URL) (anchors []*anchor) {
+	seen := make(map[string]bool)
+	z := html.NewTokenizer(b)
+
+	// current is the anchor we're within, if any.
+	var current *anchor
+	var text []string
+
+	for {
+		tt := z.Next()
+
+		switch {
+		case tt == html.ErrorToken:
+			return
+		case tt == html.TextToken && current != nil:
+			text = append(text, string(z.Text()))
+		case tt == html.EndTagToken:
+			if t := z.Token(); t.Data == "a" && current != nil {
+				if joined := strings.Join(strings.Fields(strings.Join(text, " ")), " "); len(joined) > 0 {
+					current.Text = joined
+				}
+				current = nil
+			}
+		case tt == html.StartTagToken || tt == html.SelfClosingTagToken:
+			t := z.Token()
+
+			if t.Data == "img" && current != nil {
+				text = append(text, getAttr("alt", t.Attr))
+				continue
+			}
+
+			if t.Data != "a" {
+				continue
+			}
+
+			href := strings.TrimSpace(getAttr("href", t.Attr))
+			if len(href) == 0 || strings.HasPrefix(href, "#") {
+				continue
+			}
+
+			uri, err := url.Parse(href)
+			if err != nil {
+				continue
+			}
+
+			// resolve relative links (e.g. "../about", "?page=2") against
+			// the page they were found on.
+			uri = parent.ResolveReference(uri)
+
+			if uri.Scheme != "http" && uri.Scheme != "https" {
+				continue
+			}
+
+			uri.Fragment = ""
+			if len(uri.Path) == 0 {
+				uri.Path = "/"
+			}
+
+			if seen[uri.String()] {
+				continue
+			}
+			seen[uri.String()] = true
+
+			link := &anchor{
+				URL:      uri.String(),
+				Text:     getAttr("title", t.Attr),
+				NoFollow: strings.Contains(strings.ToLower(getAttr("rel", t.Attr)), "nofollow"),
+			}
+			anchors = append(anchors, link)
+
+			if tt == html.StartTagToken {
+				current, text = link, nil
 			}
-		}
-		if !isIn {
-			tmp = append(tmp, dom)
 		}
 	}
+}
 
-	*domains = tmp
+// getLinks crawls the body of a page, yielding all <a href> links which are
+// on the same host as the page, so they can later be spidered. Links marked
+// with rel="nofollow" are skipped.
+func getLinks(b io.Reader, parent *url.URL) (urls []string) {
+	urls = []string{}
 
-	return
+	for _, link := range getAnchors(b, parent) {
+		if link.NoFollow {
+			continue
+		}
+
+		if uri, err := url.Parse(link.URL); err == nil && strings.EqualFold(uri.Host, parent.Host) {
+			urls = append(urls, link.URL)
+		}
+	}
+
+	return urls
 }
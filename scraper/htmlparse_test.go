@@ -5,6 +5,8 @@
 package scraper
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/lrstanley/marill/utils"
@@ -48,3 +50,136 @@ func TestFmtTagLinks(t *testing.T) {
 		}
 	}
 }
+
+func TestGetLinks(t *testing.T) {
+	body := `<html><body>
+		<a href="/about">about</a>
+		<a href="contact#form">contact</a>
+		<a href="../up">up</a>
+		<a href="?page=2">page 2</a>
+		<a href="#top">top</a>
+		<a href="">empty</a>
+		<a href="/about">duplicate</a>
+		<a href="/login" rel="nofollow">login</a>
+		<a href="http://example.com">root</a>
+		<a href="https://example.com/secure">secure</a>
+		<a href="http://other.com/">remote</a>
+		<a href="//other.com/">remote</a>
+		<a href="mailto:me@example.com">mail</a>
+		<a href="javascript:void(0)">js</a>
+		<link rel="stylesheet" href="/main.css">
+	</body></html>`
+
+	want := []string{
+		"http://example.com/about",
+		"http://example.com/sub/contact",
+		"http://example.com/up",
+		"http://example.com/sub/page?page=2",
+		"http://example.com/",
+		"https://example.com/secure",
+	}
+
+	out := getLinks(strings.NewReader(body), utils.MustURL("http://example.com/sub/page", ""))
+
+	if strings.Join(out, " ") != strings.Join(want, " ") {
+		t.Fatalf("getLinks() == %q, wanted %q", out, want)
+	}
+
+	return
+}
+
+func TestGetSrc(t *testing.T) {
+	body := `<html><head>
+		<link rel="stylesheet" href="/main.css">
+		<link rel="alternate stylesheet" href="/alt.css">
+		<link rel="shortcut icon" href="/favicon.ico">
+		<link rel="apple-touch-icon" href="/touch.png">
+		<link rel="preload" as="font" href="/font.woff2" crossorigin>
+		<link rel="preload" href="/preload.js">
+		<link rel="modulepreload" href="/module.mjs">
+		<link rel="manifest" href="/site.webmanifest">
+		<link rel="canonical" href="/canonical">
+		<link rel="dns-prefetch" href="//cdn.example.com">
+		<script src="/app.js"></script>
+		<style>
+			body { background: url('/bg.png'); }
+			@font-face { font-family: x; src: url(/inline.woff); }
+		</style>
+	</head><body style="background-image: url(&quot;/body.jpg&quot;)">
+		<img src="/a.png" srcset="/a-1x.png 1x, /a-2x.png 2x">
+		<img src="data:image/png;base64,iVBORw0KGgo=">
+		<picture><source srcset="/b.webp" type="image/webp"><img src="/b.jpg"></picture>
+		<video src="/intro.mp4" poster="/poster.jpg"><source src="/intro.webm"><track src="/subs.vtt"></video>
+		<audio><source src="/sound.mp3"></audio>
+		<iframe src="https://example.com/embed"></iframe>
+		<img src="/a.png">
+	</body></html>`
+
+	want := []string{
+		"style http://example.com/main.css",
+		"style http://example.com/alt.css",
+		"image http://example.com/favicon.ico",
+		"image http://example.com/touch.png",
+		"font http://example.com/font.woff2",
+		"script http://example.com/preload.js",
+		"script http://example.com/module.mjs",
+		"other http://example.com/site.webmanifest",
+		"script http://example.com/app.js",
+		"font http://example.com/inline.woff",
+		"image http://example.com/bg.png",
+		"image http://example.com/body.jpg",
+		"image http://example.com/a.png",
+		"image http://example.com/a-1x.png",
+		"image http://example.com/a-2x.png",
+		"image http://example.com/b.webp",
+		"image http://example.com/b.jpg",
+		"media http://example.com/intro.mp4",
+		"image http://example.com/poster.jpg",
+		"media http://example.com/intro.webm",
+		"media http://example.com/subs.vtt",
+		"media http://example.com/sound.mp3",
+		"frame https://example.com/embed",
+	}
+
+	var out []string
+	for _, asset := range getSrc(strings.NewReader(body), utils.MustURL("http://example.com/", "")) {
+		out = append(out, asset.Kind+" "+asset.URL)
+	}
+
+	if strings.Join(out, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("getSrc() == %q, wanted %q", out, want)
+	}
+
+	return
+}
+
+func TestGetAnchors(t *testing.T) {
+	body := `<html><body>
+		<a href="/about">  About
+			<em>us</em> </a>
+		<a href="/contact" title="Contact us"></a>
+		<a href="/home"><img src="/logo.png" alt="Home"></a>
+		<a href="/about">About (again)</a>
+		<a href="http://other.com/" rel="nofollow noopener">Other</a>
+		<a href="#top">Top</a>
+		<a href="mailto:me@example.com">Mail</a>
+	</body></html>`
+
+	want := []string{
+		"http://example.com/about [About us] false",
+		"http://example.com/contact [Contact us] false",
+		"http://example.com/home [Home] false",
+		"http://other.com/ [Other] true",
+	}
+
+	var out []string
+	for _, link := range getAnchors(strings.NewReader(body), utils.MustURL("http://example.com/", "")) {
+		out = append(out, fmt.Sprintf("%s [%s] %t", link.URL, link.Text, link.NoFollow))
+	}
+
+	if strings.Join(out, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("getAnchors() == %q, wanted %q", out, want)
+	}
+
+	return
+}
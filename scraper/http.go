@@ -10,6 +10,7 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
 	"unicode/utf8"
@@ -17,6 +18,9 @@ import (
 	"github.com/lrstanley/marill/utils"
 )
 
+// userAgent is the (spoofed) user agent all requests are made with.
+const userAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.79 Safari/537.36"
+
 // CustomClient is the state for our custom http wrapper, which houses
 // the needed data to be able to rewrite the outgoing request during
 // redirects.
@@ -25,7 +29,12 @@ type CustomClient struct {
 	Host      string
 	ResultURL url.URL  // represents the url for the resulting request, without modifications
 	OriginURL *url.URL // represents the url from the original request, without modifications
+	Method    string   // request method, GET if empty
+	Redirects []string // urls which the request was redirected to, in order
+	SameHost  bool     // only allow redirects to the hosts being scanned, regardless of the path requested
 	ipmap     map[string]string
+	profiles  []*Profile
+	route     func(host string) string
 }
 
 // CustomResponse is the wrapped response from http.Client.Do() which also
@@ -33,8 +42,17 @@ type CustomClient struct {
 // extras.
 type CustomResponse struct {
 	*http.Response
-	Time *utils.TimerResult
-	URL  *url.URL
+	Time  *utils.TimerResult
+	URL   *url.URL
+	trace *requestTrace
+}
+
+// Timings returns the durations of each phase of the request. It should be
+// called once the response body has been read.
+func (r *CustomResponse) Timings() *Timings {
+	r.trace.done()
+
+	return r.trace.Timings()
 }
 
 // ErrTooManyRedirects indicates that the requested origin redirected more
@@ -46,9 +64,33 @@ var ErrTooManyRedirects = errors.New("too many redirects (10+)")
 // we were originally looking up.
 var ErrNotMatchOrigin = errors.New("redirection does not match origin host")
 
+// isNotMatchOrigin returns true if err is ErrNotMatchOrigin, including when
+// it has been wrapped by http.Client (as a *url.Error).
+func isNotMatchOrigin(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+
+	return err == ErrNotMatchOrigin
+}
+
 func (c *CustomClient) redirectHandler(req *http.Request, via []*http.Request) error {
+	// the host being redirected to, before it's rewritten to the ip. relative
+	// redirects keep the Host header of the previous (rewritten) request.
+	target := *req.URL
+	if len(req.Host) > 0 {
+		target.Host = req.Host
+	}
+
+	stripProfiles(c.profiles, req)
 	c.requestWrap(req)
 
+	redirect := *req.URL
+	if len(req.Host) > 0 {
+		redirect.Host = req.Host
+	}
+	c.Redirects = append(c.Redirects, redirect.String())
+
 	// rewrite Referer (Referrer) if it exists, to have the proper hostname
 	uri := via[len(via)-1].URL
 	uri.Host = via[len(via)-1].Host
@@ -59,14 +101,14 @@ func (c *CustomClient) redirectHandler(req *http.Request, via []*http.Request) e
 		return ErrTooManyRedirects
 	}
 
-	if reIP.MatchString(req.Host) && req.Host != c.Host {
+	if utils.IsIP(target.Hostname()) && target.Host != c.Host {
 		return ErrNotMatchOrigin
 	}
 
 	// check to see if we're redirecting to a target which is possibly off this server
 	// or not in this session of crawls
 	if _, ok := c.ipmap[req.Host]; !ok {
-		if c.OriginURL.Path == "" {
+		if c.OriginURL.Path == "" || c.SameHost {
 			// it's not in as a host -> ip map, but let's check to see if it resolves to a target ip
 			var isin bool
 			for _, val := range c.ipmap {
@@ -88,25 +130,51 @@ func (c *CustomClient) redirectHandler(req *http.Request, via []*http.Request) e
 func (c *CustomClient) requestWrap(req *http.Request) *http.Request {
 	// spoof useragent, as there are going to be sites/servers that are
 	// setup to deny by a specific useragent string (or lack there of)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.79 Safari/537.36")
+	req.Header.Set("User-Agent", userAgent)
 
 	// add a few other misc. headers here that are needed
 	req.Header.Set("Accept-Language", "en-US,en;q=0.8")
 
-	// if an IP address is provided, rewrite the Host headers
-	// of note: if we plan to support custom ports, these should be rewritten
-	// within the header. E.g. "hostname.com:8080" -- though, common ports like
-	// 80 and 443 are left out.
+	// internationalized domains (e.g. from a redirect) are always requested
+	// in their punycode form, which is also how they're stored in ipmap.
+	if host, err := utils.ToASCII(req.URL.Host); err == nil && host != req.URL.Host {
+		if req.Host == req.URL.Host {
+			req.Host = host
+		}
+		req.URL.Host = host
+	}
+
+	// apply the request profiles (custom headers, auth, etc) which match the
+	// host, before it's rewritten to the ip. relative redirects have already
+	// been rewritten, with the host kept in the Host header.
+	host := req.URL.Host
+	if len(req.Host) > 0 {
+		host = req.Host
+	}
+	_, scanned := c.ipmap[host]
+	applyProfiles(c.profiles, req, host, scanned)
+
+	// if an IP address is provided, rewrite the Host headers. custom ports
+	// are kept within the header, e.g. "hostname.com:8080" -- though, common
+	// ports like 80 and 443 are left out.
 
 	// assign the origin host to the host header value, ONLY if it matches the domains
 	// hostname
-	if isip := net.ParseIP(req.URL.Host); isip == nil {
+	if isip := net.ParseIP(req.URL.Hostname()); isip == nil {
 		if ip, ok := c.ipmap[req.URL.Host]; ok {
 			req.Host = req.URL.Host
 
-			// and overwrite the host used to make the connection
-			if len(ip) > 0 {
-				req.URL.Host = ip
+			// and overwrite the host used to make the connection, unless
+			// it's routed directly or through a proxy.
+			if len(ip) > 0 && (c.route == nil || c.route(req.Host) == RoutePinned) {
+				if port := req.URL.Port(); port != "" {
+					req.URL.Host = net.JoinHostPort(ip, port)
+				} else if strings.Contains(ip, ":") {
+					// ipv6, which must be enclosed in brackets.
+					req.URL.Host = "[" + ip + "]"
+				} else {
+					req.URL.Host = ip
+				}
 			}
 		}
 
@@ -251,17 +319,32 @@ func VerifyHostname(c *tls.ConnectionState, host string) error {
 		return nil
 	}
 
+	// certificates don't include the port, for non-standard ports.
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
 	return verifyx509(c.PeerCertificates[0], host)
 }
 
 // getHandler wraps the standard net/http library, allowing us to spoof hostnames and IP addresses
 func (c *Crawler) getHandler(cl *CustomClient) (*CustomResponse, error) {
+	// the server name (SNI) doesn't include the port, for non-standard ports.
+	serverName := cl.Host
+	if host, _, err := net.SplitHostPort(serverName); err == nil {
+		serverName = host
+	}
+
 	transport := &http.Transport{
+		Proxy: c.proxy,
 		TLSClientConfig: &tls.Config{
 			// unfortunately, ServerName will not persist over a redirect. so... we have to ignore
 			// ssl invalidations and do them somewhat manually.
 			InsecureSkipVerify: true,
-			ServerName:         cl.Host,
+			ServerName:         serverName,
+			// allow outdated protocol versions, so they can be reported
+			// on (rather than the request simply failing).
+			MinVersion: tls.VersionTLS10,
 		},
 	}
 	client := &http.Client{
@@ -270,12 +353,21 @@ func (c *Crawler) getHandler(cl *CustomClient) (*CustomResponse, error) {
 		Transport:     transport,
 	}
 
-	req, err := http.NewRequest("GET", cl.URL, nil)
+	method := cl.Method
+	if len(method) == 0 {
+		method = "GET"
+	}
+
+	req, err := http.NewRequest(method, cl.URL, nil)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// track how long each phase of the request takes (dns, tls, etc).
+	trace := &requestTrace{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
 	cl.OriginURL = req.URL // set origin url for use in redirect wrapper
 	cl.requestWrap(req)
 
@@ -288,6 +380,10 @@ func (c *Crawler) getHandler(cl *CustomClient) (*CustomResponse, error) {
 	// stop tracking the request
 	timer.End()
 
+	if err == nil {
+		decodeBody(resp)
+	}
+
 	if err == nil && !c.Cnf.AllowInsecure {
 		if err = VerifyHostname(resp.TLS, cl.ResultURL.Host); err != nil {
 			return nil, err
@@ -295,18 +391,24 @@ func (c *Crawler) getHandler(cl *CustomClient) (*CustomResponse, error) {
 	}
 
 	if len(cl.ResultURL.Host) > 0 {
-		return &CustomResponse{resp, timer.Result, &cl.ResultURL}, err
+		return &CustomResponse{resp, timer.Result, &cl.ResultURL, trace}, err
 	}
 
-	return &CustomResponse{resp, timer.Result, req.URL}, err
+	return &CustomResponse{resp, timer.Result, req.URL, trace}, err
 }
 
 // Get wraps GetHandler -- easy interface for making get requests
 func (c *Crawler) Get(url string) (*CustomResponse, error) {
+	return c.get(url, false)
+}
+
+// get is Get, optionally only allowing redirects to the hosts being scanned
+// (see CustomClient.SameHost).
+func (c *Crawler) get(url string, sameHost bool) (*CustomResponse, error) {
 	host, err := utils.GetHost(url)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.getHandler(&CustomClient{URL: url, Host: host, ipmap: c.ipmap})
+	return c.getHandler(&CustomClient{URL: url, Host: host, SameHost: sameHost, ipmap: c.ipmap, profiles: c.Cnf.Profiles, route: c.route})
 }
@@ -0,0 +1,216 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/lrstanley/go-sempool"
+	"github.com/lrstanley/marill/utils"
+)
+
+// Link represents an <a href> link within a page, and the result of checking
+// it.
+type Link struct {
+	URL       string   // URL is the absolute url of the link
+	Text      string   // Text is the anchor text of the link
+	Internal  bool     // Internal is true if the link is to one of the scanned domains (and was requested through its ip)
+	Method    string   // Method is the method of the request which decided the result (HEAD, or GET if HEAD failed)
+	Code      int      // Code is the resulting HTTP status code, after redirects
+	Redirects []string // Redirects is the chain of urls the link redirected to, if any
+	Error     error    `json:"-"` // Error is the error which occurred while checking the link, if any
+}
+
+// Broken returns true if the link couldn't be loaded, or returned an error
+// status code.
+func (l *Link) Broken() bool {
+	return l.Error != nil || l.Code >= 400
+}
+
+func (l *Link) String() string {
+	return fmt.Sprintf("<[Link] url:%q text:%q internal:%t method:%s code:%d redirects:%q err:%q>", l.URL, l.Text, l.Internal, l.Method, l.Code, l.Redirects, l.Error)
+}
+
+// BrokenLinks returns the links within the page which are broken.
+func (r *FetchResult) BrokenLinks() (broken []*Link) {
+	for _, link := range r.Links {
+		if link.Broken() {
+			broken = append(broken, link)
+		}
+	}
+
+	return broken
+}
+
+// linkCache caches the results of link checks, as the same links are
+// usually found on many pages (e.g. within the navigation or footer).
+type linkCache struct {
+	sync.Mutex
+	links map[string]*Link
+}
+
+// check checks the link, or copies the result from a previous check of the
+// same url.
+func (lc *linkCache) check(link *Link, check func(*Link)) {
+	lc.Lock()
+	cached, ok := lc.links[link.URL]
+	lc.Unlock()
+
+	if !ok {
+		check(link)
+
+		lc.Lock()
+		lc.links[link.URL] = link
+		lc.Unlock()
+
+		return
+	}
+
+	link.Method, link.Code, link.Redirects, link.Error = cached.Method, cached.Code, cached.Redirects, cached.Error
+}
+
+// getExternal requests an external url (one that isn't being scanned, and
+// thus shouldn't be pinned to an ip), using the timeout configured for link
+// checks, returning the status code and redirect chain.
+func (c *Crawler) getExternal(method, uri string) (code int, redirects []string, err error) {
+	timeout := c.Cnf.LinkTimeout
+	if timeout < 1 {
+		timeout = c.Cnf.HTTPTimeout
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:             c.proxy,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: c.Cnf.AllowInsecure},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > 10 {
+				return ErrTooManyRedirects
+			}
+
+			redirects = append(redirects, req.URL.String())
+
+			stripProfiles(c.Cnf.Profiles, req)
+			applyProfiles(c.Cnf.Profiles, req, req.URL.Host, false)
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest(method, uri, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept-Language", "en-US,en;q=0.8")
+	applyProfiles(c.Cnf.Profiles, req, req.URL.Host, false)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, redirects, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, redirects, nil
+}
+
+// getInternal requests a url on one of the scanned domains, through the ip
+// of the domain (see CustomClient), returning the status code and redirect
+// chain.
+func (c *Crawler) getInternal(method, uri string) (code int, redirects []string, err error) {
+	host, err := utils.GetHost(uri)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	cl := &CustomClient{URL: uri, Host: host, Method: method, ipmap: c.ipmap, profiles: c.Cnf.Profiles, route: c.route}
+	resp, err := c.getHandler(cl)
+	if err != nil {
+		return 0, cl.Redirects, err
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	return resp.StatusCode, cl.Redirects, nil
+}
+
+// checkLink requests the link with HEAD, falling back to GET if that fails
+// (as many servers don't support HEAD, or handle it differently).
+func (c *Crawler) checkLink(link *Link) {
+	get := c.getExternal
+	if link.Internal {
+		get = c.getInternal
+	}
+
+	for _, method := range []string{"HEAD", "GET"} {
+		link.Method = method
+		link.Code, link.Redirects, link.Error = get(method, link.URL)
+
+		if !link.Broken() {
+			break
+		}
+	}
+
+	if link.Broken() {
+		c.Log.Printf("found broken link: %s", link)
+	}
+}
+
+// checkLinks checks all <a href> links within the page, adding them to
+// res.Links. Internal links are checked a few at a time per page, and
+// external links are limited by Cnf.LinkThreads across all pages.
+func (c *Crawler) checkLinks(res *FetchResult) {
+	if res.Response.URL == nil {
+		return
+	}
+
+	if ctype := res.Response.Headers.Get("Content-Type"); ctype != "" && !strings.Contains(ctype, "html") {
+		return
+	}
+
+	pool := sempool.New(4)
+	var wg sync.WaitGroup
+
+	for _, anchor := range getAnchors(strings.NewReader(res.Response.Body), res.Response.URL) {
+		uri, err := url.Parse(anchor.URL)
+		if err != nil {
+			continue
+		}
+
+		_, internal := c.ipmap[uri.Host]
+		link := &Link{URL: anchor.URL, Text: anchor.Text, Internal: internal}
+		res.Links = append(res.Links, link)
+
+		free := c.linkPool.Free
+		if internal {
+			pool.Slot()
+			free = pool.Free
+		} else {
+			c.linkPool.Slot()
+		}
+
+		wg.Add(1)
+		go func(link *Link, free func()) {
+			defer wg.Done()
+			defer free()
+
+			c.links.check(link, c.checkLink)
+		}(link, free)
+	}
+
+	wg.Wait()
+	pool.Wait()
+
+	c.Log.Printf("checked %d links on %s, %d broken", len(res.Links), res.Response.URL, len(res.BrokenLinks()))
+}
@@ -0,0 +1,118 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer external.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	var host string
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != host {
+			// the request wasn't pinned to the ip of the domain.
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><body>
+				<a href="/ok">OK <b>page</b></a>
+				<a href="/missing" title="Missing page"></a>
+				<a href="/no-head"><img alt="No HEAD"></a>
+				<a href="/redirect">Redirect</a>
+				<a href="%[1]s/">External</a>
+				<a href="%[1]s/gone">Gone</a>
+				<a href="%[2]s/">Closed</a>
+				<a href="mailto:me@example.com">Mail</a>
+			</body></html>`, external.URL, closed.URL)
+		case "/ok":
+		case "/no-head":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/redirect":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer internal.Close()
+
+	uri, _ := url.Parse(internal.URL)
+	uri.Host = "example.com:" + uri.Port()
+	uri.Path = "/"
+	host = uri.Host
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+	crawler.Cnf.Threads = 1
+	crawler.Cnf.CheckLinks = true
+	crawler.Cnf.LinkThreads = 2
+	crawler.Crawl()
+
+	res := GetResults(crawler, uri.String(), "127.0.0.1")
+	if res == nil || res.Error != nil {
+		t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+	}
+
+	cases := []struct {
+		url       string
+		text      string
+		internal  bool
+		method    string
+		code      int
+		redirects string
+		broken    bool
+	}{
+		{url: "http://" + host + "/ok", text: "OK page", internal: true, method: "HEAD", code: 200},
+		{url: "http://" + host + "/missing", text: "Missing page", internal: true, method: "GET", code: 404, broken: true},
+		{url: "http://" + host + "/no-head", text: "No HEAD", internal: true, method: "GET", code: 200},
+		{url: "http://" + host + "/redirect", text: "Redirect", internal: true, method: "HEAD", code: 200, redirects: "http://" + host + "/ok"},
+		{url: external.URL + "/", text: "External", method: "HEAD", code: 200},
+		{url: external.URL + "/gone", text: "Gone", method: "GET", code: 410, broken: true},
+		{url: closed.URL + "/", text: "Closed", method: "GET", broken: true},
+	}
+
+	if len(res.Links) != len(cases) {
+		t.Fatalf("checkLinks() == %s, wanted %d links", res.Links, len(cases))
+	}
+
+	for i, c := range cases {
+		link := res.Links[i]
+
+		if link.URL != c.url || link.Text != c.text || link.Internal != c.internal || link.Method != c.method || link.Code != c.code || strings.Join(link.Redirects, " ") != c.redirects {
+			t.Fatalf("checkLink(%q) == %s, wanted %+v", c.url, link, c)
+		}
+
+		if link.Broken() != c.broken {
+			t.Fatalf("checkLink(%q).Broken() == %t, wanted %t", c.url, link.Broken(), c.broken)
+		}
+	}
+
+	if broken := len(res.BrokenLinks()); broken != 3 {
+		t.Fatalf("BrokenLinks() == %d links, wanted 3", broken)
+	}
+
+	return
+}
@@ -0,0 +1,44 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import "net/url"
+
+// Kinds of mixed content, as stored in Resource.Mixed.
+const (
+	// MixedActive is http content on an https page which browsers block
+	// outright (scripts, stylesheets, frames, fonts, etc).
+	MixedActive = "active"
+	// MixedPassive is http content on an https page which browsers still
+	// load (or upgrade to https), with a warning (images, audio and video).
+	MixedPassive = "passive"
+)
+
+// mixedContent returns the kind of mixed content an asset of the given kind
+// at uri is, when loaded from page, or an empty string if it isn't.
+func mixedContent(page, uri *url.URL, kind string) string {
+	if page == nil || page.Scheme != "https" || uri.Scheme != "http" {
+		return ""
+	}
+
+	switch kind {
+	case AssetImage, AssetMedia:
+		return MixedPassive
+	}
+
+	return MixedActive
+}
+
+// MixedContent returns the assets of the page which are mixed content of
+// the given kind (MixedActive or MixedPassive).
+func (r *FetchResult) MixedContent(kind string) (assets []*Resource) {
+	for _, asset := range r.Assets {
+		if asset.Mixed == kind {
+			assets = append(assets, asset)
+		}
+	}
+
+	return assets
+}
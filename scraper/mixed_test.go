@@ -0,0 +1,118 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+func TestMixedContent(t *testing.T) {
+	cases := []struct {
+		page string
+		in   string
+		kind string
+		want string
+	}{
+		{"https://example.com/", "http://example.com/app.js", AssetScript, MixedActive},
+		{"https://example.com/", "http://cdn.com/style.css", AssetStyle, MixedActive},
+		{"https://example.com/", "http://example.com/font.woff2", AssetFont, MixedActive},
+		{"https://example.com/", "http://example.com/frame.html", AssetFrame, MixedActive},
+		{"https://example.com/", "http://example.com/feed", AssetOther, MixedActive},
+		{"https://example.com/", "http://example.com/logo.png", AssetImage, MixedPassive},
+		{"https://example.com/", "http://example.com/intro.mp4", AssetMedia, MixedPassive},
+		{"https://example.com/", "https://example.com/app.js", AssetScript, ""},
+		{"http://example.com/", "http://example.com/app.js", AssetScript, ""},
+		{"http://example.com/", "https://example.com/app.js", AssetScript, ""},
+	}
+
+	for _, c := range cases {
+		page, uri := utils.MustURL(c.page, ""), utils.MustURL(c.in, "")
+
+		if out := mixedContent(page, uri, c.kind); out != c.want {
+			t.Fatalf("mixedContent(%q, %q, %q) == %q, wanted %q", c.page, c.in, c.kind, out, c.want)
+		}
+	}
+
+	return
+}
+
+func TestFetchMixedContent(t *testing.T) {
+	insecure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer insecure.Close()
+
+	var host string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != host {
+			// the request wasn't pinned to the ip of the domain.
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><head>
+				<script src="%[1]s/app.js"></script>
+				<link rel="stylesheet" href="%[1]s/style.css">
+				<script src="/secure.js"></script>
+			</head><body>
+				<img src="%[1]s/logo.png">
+				<video src="%[1]s/intro.mp4"></video>
+			</body></html>`, insecure.URL)
+		case "/secure.js":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	uri.Host = "example.com:" + uri.Port()
+	uri.Path = "/"
+	host = uri.Host
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+	crawler.Cnf.Threads = 1
+	crawler.Cnf.Assets = true
+	crawler.Cnf.AllowInsecure = true
+	crawler.Crawl()
+
+	res := GetResults(crawler, uri.String(), "127.0.0.1")
+	if res == nil || res.Error != nil {
+		t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+	}
+
+	cases := []struct {
+		kind string
+		want string // wanted paths of the mixed content
+	}{
+		{MixedActive, "/app.js /style.css"},
+		{MixedPassive, "/intro.mp4 /logo.png"},
+	}
+
+	for _, c := range cases {
+		var paths []string
+		for _, asset := range res.MixedContent(c.kind) {
+			paths = append(paths, asset.Request.URL.Path)
+		}
+		sort.Strings(paths)
+
+		if out := strings.Join(paths, " "); out != c.want {
+			t.Fatalf("MixedContent(%q) == %q, wanted %q", c.kind, out, c.want)
+		}
+	}
+
+	return
+}
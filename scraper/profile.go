@@ -0,0 +1,212 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+// Profile is a set of changes made to requests, e.g. to authenticate with a
+// staging site, or to get past a WAF with a bypass header.
+type Profile struct {
+	Match          string            `json:"match"`           // glob of hostnames the profile applies to, empty for all scanned domains
+	UserAgent      string            `json:"user_agent"`      // User-Agent to make requests with
+	Headers        map[string]string `json:"headers"`         // headers to add to requests
+	Cookies        map[string]string `json:"cookies"`         // cookies to add to requests
+	BasicAuth      string            `json:"basic_auth"`      // "user:password" to authenticate requests with
+	BearerToken    string            `json:"bearer_token"`    // bearer token to authenticate requests with
+	AcceptEncoding string            `json:"accept_encoding"` // Accept-Encoding to make requests with (only gzip, deflate and identity are supported)
+}
+
+// Validate returns an error if the profile is invalid.
+func (p *Profile) Validate() error {
+	if len(p.BasicAuth) > 0 && !strings.Contains(p.BasicAuth, ":") {
+		return errors.New("basic auth must be in the form \"user:password\"")
+	}
+
+	if len(p.BasicAuth) > 0 && len(p.BearerToken) > 0 {
+		return errors.New("basic auth and bearer token can't both be used")
+	}
+
+	if err := validateEncoding(p.AcceptEncoding); err != nil {
+		return err
+	}
+
+	for name, value := range p.Headers {
+		if len(name) == 0 || strings.ContainsAny(name, " \t:") {
+			return fmt.Errorf("invalid header name: %q", name)
+		}
+
+		if http.CanonicalHeaderKey(name) == "Accept-Encoding" {
+			if err := validateEncoding(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name := range p.Cookies {
+		if len(name) == 0 || strings.ContainsAny(name, " \t=;") {
+			return fmt.Errorf("invalid cookie name: %q", name)
+		}
+	}
+
+	return nil
+}
+
+// validateEncoding returns an error if an Accept-Encoding value contains
+// encodings which decodeBody can't decompress (e.g. br), as the responses
+// couldn't be parsed.
+func validateEncoding(value string) error {
+	for _, enc := range strings.Split(value, ",") {
+		// strip the quality value, e.g. "gzip;q=0.8".
+		if i := strings.Index(enc, ";"); i > -1 {
+			enc = enc[:i]
+		}
+
+		switch strings.ToLower(strings.TrimSpace(enc)) {
+		case "", "gzip", "x-gzip", "deflate", "identity", "*":
+		default:
+			return fmt.Errorf("unsupported accept encoding %q (must be gzip, deflate or identity)", strings.TrimSpace(enc))
+		}
+	}
+
+	return nil
+}
+
+// Matches returns true if the profile applies to requests to host. Profiles
+// without a match only apply to the domains being scanned, so credentials
+// aren't sent to third parties (e.g. a CDN hosting assets).
+func (p *Profile) Matches(host string, scanned bool) bool {
+	if len(p.Match) == 0 {
+		return scanned
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return utils.Glob(host, p.Match)
+}
+
+// apply makes the changes of the profile to req.
+func (p *Profile) apply(req *http.Request) {
+	if len(p.UserAgent) > 0 {
+		req.Header.Set("User-Agent", p.UserAgent)
+	}
+
+	for name, value := range p.Headers {
+		req.Header.Set(name, value)
+	}
+
+	for name, value := range p.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+
+	if i := strings.Index(p.BasicAuth, ":"); i > -1 {
+		req.SetBasicAuth(p.BasicAuth[:i], p.BasicAuth[i+1:])
+	}
+
+	if len(p.BearerToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+p.BearerToken)
+	}
+
+	if len(p.AcceptEncoding) > 0 {
+		req.Header.Set("Accept-Encoding", p.AcceptEncoding)
+	}
+}
+
+// applyProfiles applies each profile which matches host (the host req is
+// for, before it's rewritten to an ip), in order (so later profiles override
+// earlier ones).
+func applyProfiles(profiles []*Profile, req *http.Request, host string, scanned bool) {
+	for _, profile := range profiles {
+		if profile.Matches(host, scanned) {
+			profile.apply(req)
+		}
+	}
+}
+
+// stripProfiles removes everything the profiles could have set on req. When
+// following a redirect, net/http copies the headers of the original request
+// (only dropping credentials for other domains), so they must be removed
+// before the profiles matching the new host are applied.
+func stripProfiles(profiles []*Profile, req *http.Request) {
+	for _, profile := range profiles {
+		for name := range profile.Headers {
+			req.Header.Del(name)
+		}
+
+		if len(profile.UserAgent) > 0 {
+			req.Header.Set("User-Agent", userAgent)
+		}
+
+		if len(profile.Cookies) > 0 {
+			req.Header.Del("Cookie")
+		}
+
+		if len(profile.BasicAuth) > 0 || len(profile.BearerToken) > 0 {
+			req.Header.Del("Authorization")
+		}
+
+		if len(profile.AcceptEncoding) > 0 {
+			req.Header.Del("Accept-Encoding")
+		}
+	}
+}
+
+// decodedBody wraps a decompressing reader, closing the original body too.
+type decodedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	if c, ok := b.Reader.(io.Closer); ok {
+		c.Close()
+	}
+
+	return b.body.Close()
+}
+
+// decodeBody decompresses the body of resp, if it was compressed with gzip
+// or deflate. This is only needed when a profile sets Accept-Encoding, as
+// otherwise net/http requests (and decompresses) gzip on its own.
+func decodeBody(resp *http.Response) {
+	if resp.Uncompressed || resp.Body == nil {
+		return
+	}
+
+	var reader io.Reader
+	var err error
+
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(resp.Body)
+	default:
+		return
+	}
+
+	if err != nil {
+		// e.g. an empty body.
+		return
+	}
+
+	resp.Body = &decodedBody{Reader: reader, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
@@ -0,0 +1,150 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestProfileValidate(t *testing.T) {
+	cases := []struct {
+		in      *Profile
+		wantErr bool
+	}{
+		{&Profile{}, false},
+		{&Profile{BasicAuth: "user:pass", Headers: map[string]string{"X-Bypass": "secret"}}, false},
+		{&Profile{BasicAuth: "user"}, true},
+		{&Profile{BasicAuth: "user:pass", BearerToken: "token"}, true},
+		{&Profile{Headers: map[string]string{"X Bypass": "secret"}}, true},
+		{&Profile{Cookies: map[string]string{"a=b": "c"}}, true},
+		{&Profile{AcceptEncoding: "gzip, deflate;q=0.5, identity"}, false},
+		{&Profile{AcceptEncoding: "gzip, br"}, true},
+		{&Profile{Headers: map[string]string{"accept-encoding": "zstd"}}, true},
+	}
+
+	for _, c := range cases {
+		if err := c.in.Validate(); (err != nil) != c.wantErr {
+			t.Fatalf("%+v.Validate() == %v, wanted error: %t", c.in, err, c.wantErr)
+		}
+	}
+
+	return
+}
+
+func TestCrawlProfiles(t *testing.T) {
+	// external records what it was sent, as a scan-wide profile shouldn't
+	// leak credentials to third parties.
+	sent := make(chan string, 10)
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent <- fmt.Sprintf("%s auth:%q bypass:%q cookie:%q ua:%q", r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("X-Bypass"), r.Header.Get("Cookie"), r.UserAgent())
+	}))
+	defer external.Close()
+
+	var host string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		session, _ := r.Cookie("session")
+
+		// cookies shouldn't be duplicated when following redirects.
+		if r.Host != host || !ok || user != "user" || pass != "pass" || session == nil || session.Value != "abc" || len(r.Cookies()) != 1 ||
+			r.Header.Get("X-Bypass") != "secret" || r.UserAgent() != "marill-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/":
+			// served gzipped, as a profile set Accept-Encoding.
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipBytes([]byte(fmt.Sprintf(`<html><head>
+				<script src="/app.js"></script>
+				<script src="%s/external.js"></script>
+				<script src="/moved.js"></script>
+				<script src="/cdn.js"></script>
+			</head><body>ok</body></html>`, external.URL))))
+		case "/moved.js":
+			http.Redirect(w, r, "/app.js", http.StatusFound)
+		case "/cdn.js":
+			// a host which isn't being scanned, so the profiles shouldn't
+			// follow the redirect.
+			externalURL, _ := url.Parse(external.URL)
+			http.Redirect(w, r, "http://localhost:"+externalURL.Port()+"/cdn.js", http.StatusFound)
+		case "/app.js":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	uri.Host = "example.com:" + uri.Port()
+	uri.Path = "/"
+	host = uri.Host
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+	crawler.Cnf.Threads = 1
+	crawler.Cnf.Assets = true
+	crawler.Cnf.Profiles = []*Profile{
+		{
+			UserAgent:      "marill-test",
+			BasicAuth:      "user:wrong",
+			Cookies:        map[string]string{"session": "abc"},
+			AcceptEncoding: "gzip",
+		},
+		// later profiles override earlier ones.
+		{Match: "example.com", BasicAuth: "user:pass", Headers: map[string]string{"X-Bypass": "secret"}},
+		{Match: "127.0.0.*", Headers: map[string]string{"X-Bypass": "external"}},
+	}
+	crawler.Crawl()
+
+	res := GetResults(crawler, uri.String(), "127.0.0.1")
+	if res == nil || res.Error != nil || res.Response.Code != http.StatusOK {
+		t.Fatalf("Crawl of %q == %v, wanted status %d", uri, res, http.StatusOK)
+	}
+
+	if !strings.Contains(res.Response.Body, "<body>ok</body>") {
+		t.Fatalf("Crawl of %q has body %q, wanted the decoded body", uri, res.Response.Body)
+	}
+
+	for _, asset := range res.Assets {
+		if asset.Error != nil || asset.Response.Code != http.StatusOK {
+			t.Fatalf("asset %q == %s, wanted status %d", asset.URL, asset, http.StatusOK)
+		}
+	}
+
+	close(sent)
+	var requests []string
+	for req := range sent {
+		requests = append(requests, req)
+	}
+
+	// only the profile matching the external host should have applied, and
+	// none to the redirect.
+	sort.Strings(requests)
+	want := []string{
+		fmt.Sprintf(`/cdn.js auth:"" bypass:"" cookie:"" ua:%q`, userAgent),
+		fmt.Sprintf(`/external.js auth:"" bypass:"external" cookie:"" ua:%q`, userAgent),
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Fatalf("external requests == %q, wanted %q", requests, want)
+	}
+
+	return
+}
@@ -0,0 +1,373 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// proxyLog records the hosts requested through a stand-in proxy.
+type proxyLog struct {
+	sync.Mutex
+	hosts []string
+}
+
+func (l *proxyLog) add(host string) {
+	l.Lock()
+	l.hosts = append(l.hosts, host)
+	l.Unlock()
+}
+
+func (l *proxyLog) String() string {
+	l.Lock()
+	defer l.Unlock()
+
+	return strings.Join(l.hosts, " ")
+}
+
+// relay copies between a and b until either is closed.
+func relay(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+	}()
+
+	io.Copy(b, a)
+	b.Close()
+}
+
+// newHTTPProxy starts a stand-in HTTP proxy (supporting CONNECT), which
+// sends every request to target (in place of resolving the requested host),
+// and requires basic auth of "user:pass".
+func newHTTPProxy(target string, plog *proxyLog) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		plog.add(r.Host)
+
+		if r.Method == "CONNECT" {
+			conn, err := net.Dial("tcp", target)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			client, _, _ := w.(http.Hijacker).Hijack()
+			client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+			relay(client, conn)
+			return
+		}
+
+		// a plain http request, with an absolute url.
+		r.RequestURI = ""
+		r.URL.Host = target
+
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+}
+
+// newSOCKS5Proxy starts a stand-in SOCKS5 proxy, which sends every
+// connection to target (in place of resolving the requested host), and
+// requires username/password auth of "user:pass".
+func newSOCKS5Proxy(target string, plog *proxyLog) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	handle := func(client net.Conn) {
+		defer client.Close()
+		r := bufio.NewReader(client)
+
+		// greeting: version, and the auth methods supported by the client.
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(r, head); err != nil || head[0] != 5 {
+			return
+		}
+		methods := make([]byte, head[1])
+		io.ReadFull(r, methods)
+		client.Write([]byte{5, 2}) // username/password
+
+		// username/password auth (RFC 1929).
+		var creds []string
+		ver, _ := r.ReadByte()
+		for i := 0; i < 2 && ver == 1; i++ {
+			n, _ := r.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(r, b)
+			creds = append(creds, string(b))
+		}
+		if strings.Join(creds, ":") != "user:pass" {
+			client.Write([]byte{1, 1})
+			return
+		}
+		client.Write([]byte{1, 0})
+
+		// request: version, command (connect), reserved, address type.
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(r, req); err != nil || req[1] != 1 {
+			return
+		}
+
+		var host string
+		switch req[3] {
+		case 1:
+			ip := make([]byte, 4)
+			io.ReadFull(r, ip)
+			host = net.IP(ip).String()
+		case 3:
+			n, _ := r.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(r, b)
+			host = string(b)
+		default:
+			return
+		}
+		port := make([]byte, 2)
+		io.ReadFull(r, port)
+		plog.add(net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+
+		conn, err := net.Dial("tcp", target)
+		if err != nil {
+			client.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		client.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+		relay(client, conn)
+	}
+
+	go func() {
+		for {
+			client, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go handle(client)
+		}
+	}()
+
+	return ln
+}
+
+func TestCrawlProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("<html><body>" + r.Host + "</body></html>"))
+	})
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+
+	// scanned hosts are pinned unless a rule says otherwise.
+	proxyAll := []*ProxyRule{{Match: "*", Route: RouteProxy}}
+
+	cases := []struct {
+		tls     bool   // if the domain is requested over https
+		proxy   string // "http", "socks5", or "" for none
+		auth    string // credentials of the proxy
+		rules   []*ProxyRule
+		host    string // hostname of the domain
+		ip      string // ip of the domain
+		proxied bool   // if the request should have gone through the proxy
+		code    int    // wanted status code, if not 200
+		wantErr bool
+	}{
+		{proxy: "http", auth: "user:pass", rules: proxyAll, host: "example.com", ip: "127.0.0.1", proxied: true},
+		{tls: true, proxy: "http", auth: "user:pass", rules: proxyAll, host: "example.com", ip: "127.0.0.1", proxied: true},
+		{proxy: "socks5", auth: "user:pass", rules: proxyAll, host: "example.com", ip: "127.0.0.1", proxied: true},
+		{tls: true, proxy: "socks5", auth: "user:pass", rules: proxyAll, host: "example.com", ip: "127.0.0.1", proxied: true},
+		// the proxy responds on its own to plain http requests, but fails
+		// to CONNECT for https requests.
+		{proxy: "http", auth: "user:wrong", rules: proxyAll, host: "example.com", ip: "127.0.0.1", code: http.StatusProxyAuthRequired},
+		{tls: true, proxy: "http", auth: "user:wrong", rules: proxyAll, host: "example.com", ip: "127.0.0.1", wantErr: true},
+		{proxy: "socks5", auth: "user:wrong", rules: proxyAll, host: "example.com", ip: "127.0.0.1", wantErr: true},
+		// without rules, the scanned domain is pinned (so the proxy, which
+		// would fail, isn't used).
+		{proxy: "http", auth: "user:wrong", host: "example.com", ip: "127.0.0.1"},
+		{tls: true, proxy: "socks5", auth: "user:wrong", host: "example.com", ip: "127.0.0.1"},
+		{
+			proxy: "socks5", auth: "user:pass", host: "example.com", ip: "127.0.0.1",
+			rules: []*ProxyRule{{Match: "*.example.com", Route: RouteProxy}, {Match: "example.com", Route: RoutePinned}},
+		},
+		{
+			// the ip is unroutable, so this only succeeds if "localhost" is
+			// resolved through DNS.
+			host: "localhost", ip: "192.0.2.1",
+			rules: []*ProxyRule{{Match: "localhost", Route: RouteDirect}},
+		},
+	}
+
+	for _, c := range cases {
+		target := srv
+		if c.tls {
+			target = tlsSrv
+		}
+
+		uri, _ := url.Parse(target.URL)
+		uri.Host = c.host + ":" + uri.Port()
+		uri.Path = "/"
+
+		plog := &proxyLog{}
+		var proxy *url.URL
+		switch c.proxy {
+		case "http":
+			p := newHTTPProxy(target.Listener.Addr().String(), plog)
+			defer p.Close()
+
+			proxy, _ = ParseProxy("http://" + c.auth + "@" + p.Listener.Addr().String())
+		case "socks5":
+			p := newSOCKS5Proxy(target.Listener.Addr().String(), plog)
+			defer p.Close()
+
+			proxy, _ = ParseProxy("socks5://" + c.auth + "@" + p.Addr().String())
+		}
+
+		crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+		crawler.Cnf.Domains = []*Domain{{URL: uri, IP: c.ip}}
+		crawler.Cnf.Threads = 1
+		crawler.Cnf.AllowInsecure = true
+		crawler.Cnf.HTTPTimeout = 5 * time.Second
+		crawler.Cnf.Proxy = proxy
+		crawler.Cnf.ProxyRules = c.rules
+		crawler.Crawl()
+
+		res := GetResults(crawler, uri.String(), c.ip)
+		if res == nil {
+			t.Fatalf("Crawl of %q (proxy: %s) has no results", uri, proxy)
+		}
+
+		if c.wantErr {
+			if res.Error == nil {
+				t.Fatalf("Crawl of %q (proxy: %s) == %s, wanted error", uri, proxy, res)
+			}
+
+			continue
+		}
+
+		if c.code != 0 {
+			if res.Error != nil || res.Response.Code != c.code {
+				t.Fatalf("Crawl of %q (proxy: %s) == %s, wanted status %d", uri, proxy, res, c.code)
+			}
+
+			continue
+		}
+
+		if res.Error != nil || !strings.Contains(res.Response.Body, uri.Host) {
+			t.Fatalf("Crawl of %q (proxy: %s) == %s, wanted body containing %q", uri, proxy, res, uri.Host)
+		}
+
+		if proxied := plog.String(); (proxied != "") != c.proxied || (c.proxied && proxied != uri.Host) {
+			t.Fatalf("Crawl of %q (proxy: %s) was proxied to %q, wanted proxied: %t", uri, proxy, proxied, c.proxied)
+		}
+	}
+
+	return
+}
+
+func TestCrawlProxyAssets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<script src="http://cdn.example.net:` + r.URL.Query().Get("port") + `/app.js"></script>`))
+			return
+		}
+
+		w.Write([]byte("var a = 1;"))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	uri.Host = "example.com:" + uri.Port()
+	uri.Path = "/"
+	uri.RawQuery = "port=" + uri.Port()
+
+	// the proxy sends everything to srv, as cdn.example.net doesn't resolve.
+	plog := &proxyLog{}
+	p := newHTTPProxy(srv.Listener.Addr().String(), plog)
+	defer p.Close()
+	proxy, _ := ParseProxy("http://user:pass@" + p.Listener.Addr().String())
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+	crawler.Cnf.Threads = 1
+	crawler.Cnf.Assets = true
+	crawler.Cnf.HTTPTimeout = 5 * time.Second
+	crawler.Cnf.Proxy = proxy
+	crawler.Crawl()
+
+	res := GetResults(crawler, uri.String(), "127.0.0.1")
+	if res == nil || res.Error != nil {
+		t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+	}
+
+	if len(res.Assets) != 1 || res.Assets[0].Error != nil || res.Assets[0].Response.Code != http.StatusOK {
+		t.Fatalf("Crawl of %q has assets %v, wanted 1 with status %d", uri, res.Assets, http.StatusOK)
+	}
+
+	// without rules, only the host which isn't being scanned is proxied.
+	if proxied, want := plog.String(), "cdn.example.net:"+uri.Port(); proxied != want {
+		t.Fatalf("Crawl of %q was proxied to %q, wanted %q", uri, proxied, want)
+	}
+
+	return
+}
+
+func TestProxyRuleValidate(t *testing.T) {
+	cases := []struct {
+		in      *ProxyRule
+		wantErr bool
+	}{
+		{&ProxyRule{Match: "*.example.com", Route: RouteProxy}, false},
+		{&ProxyRule{Match: "example.com", Route: RouteDirect}, false},
+		{&ProxyRule{Match: "", Route: RoutePinned}, true},
+		{&ProxyRule{Match: "example.com", Route: "tunnel"}, true},
+	}
+
+	for _, c := range cases {
+		if err := c.in.Validate(); (err != nil) != c.wantErr {
+			t.Fatalf("%+v.Validate() == %v, wanted error: %t", c.in, err, c.wantErr)
+		}
+	}
+
+	for _, raw := range []string{"ftp://10.0.0.1:21", "socks5://", "http://[::1"} {
+		if _, err := ParseProxy(raw); err == nil {
+			t.Fatalf("ParseProxy(%q) returned no error", raw)
+		}
+	}
+
+	return
+}
@@ -14,14 +14,13 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lrstanley/go-sempool"
 	"github.com/lrstanley/marill/utils"
 )
 
-var reIP = regexp.MustCompile(`^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}$`)
-
 // Response represents the data for the HTTP-based request, closely matching
 // http.Response
 type Response struct {
@@ -32,6 +31,7 @@ type Response struct {
 	Headers       http.Header  // Headers is a map[string][]string of headers
 	ContentLength int64        // ContentLength is the number of bytes in the body of the response
 	TLS           *TLSResponse // TLS is the SSL/TLS session if the resource was loaded over SSL/TLS
+	Timings       *Timings     // Timings are the durations of each phase of the request (dns, tls, ttfb, etc)
 }
 
 // Resource represents a single entity of many within a given crawl. These should
@@ -42,6 +42,10 @@ type Resource struct {
 	Response Response           // Response represents the end result/data/status/etc.
 	Error    error              // Error represents an error of a completely failed request
 	Time     *utils.TimerResult // Time is the time it took to complete the request
+	Kind     string             // Kind is the kind of asset the resource is (see AssetScript, AssetStyle, etc)
+	Mixed    string             // Mixed is the kind of mixed content the asset is (MixedActive or MixedPassive), if it is
+
+	links []*assetLink // assets referenced by the resource, if it's a stylesheet
 }
 
 func (r *Resource) String() string {
@@ -58,6 +62,11 @@ type FetchResult struct {
 	Assets       []*Resource        `json:"-"` // Assets containing the needed resources for the given URL
 	ResourceTime *utils.TimerResult // ResourceTime is the time it took to fetch all resources
 	TotalTime    *utils.TimerResult // TotalTime is the time it took to crawl the site
+	Origin       *Resource          // Origin is the direct request to the origin webserver, if the request through the reverse proxy failed
+	Pages        []*FetchResult     `json:"-"` // Pages are the additional pages fetched for the result, when spidering or reading its sitemap
+	Depth        int                // Depth is how many links away from the initial page this page was found
+	Source       string             `json:",omitempty"` // Source is how the page was found: "link" (spidered) or "sitemap"
+	Links        []*Link            `json:"-"`          // Links are the <a href> links within the page, if link checking
 }
 
 func (r *FetchResult) String() string {
@@ -68,11 +77,34 @@ func (r *FetchResult) String() string {
 	return fmt.Sprintf("<[Results] request:%s response:%s ip:%q err:%q>", r.Request.URL, r.URL, r.Request.IP, r.Error)
 }
 
+// FailedHop returns which hop a failed request (through a reverse proxy)
+// failed at: "origin" if the origin webserver failed when requested
+// directly, "proxy" if the origin responded fine, or "" if the request
+// wasn't through a reverse proxy, or didn't fail.
+func (r *FetchResult) FailedHop() string {
+	if r.Origin == nil {
+		return ""
+	}
+
+	if r.Origin.Error != nil || r.Origin.Response.Code >= 500 {
+		return "origin"
+	}
+
+	return "proxy"
+}
+
 // Domain represents a url we need to fetch, including the items needed to
 // fetch said url. E.g: host, port, ip, scheme, path, etc.
 type Domain struct {
 	URL *url.URL `json:"-"`
 	IP  string
+	// Origin is the origin webserver behind the reverse proxy (e.g. Varnish)
+	// which URL/IP is requested through, if any. It is only requested when
+	// the request through the proxy fails.
+	Origin *Domain `json:",omitempty"`
+	// Meta is optional metadata about where the domain came from (e.g. the
+	// owning user, document root, or config file), used within results.
+	Meta map[string]string `json:",omitempty"`
 }
 
 func (d *Domain) String() string {
@@ -85,8 +117,17 @@ type Crawler struct {
 	ipmap   map[string]string // domain -> ip map, to easily tell if something is local
 	Results []*FetchResult    // scan results, should only be access when scan is complete
 	Pool    sempool.Pool      // thread pool for fetching main resources
-	ResPool sempool.Pool      // thread pool for fetching assets
 	Cnf     CrawlerConfig
+
+	// ResPool is no longer used, as each page fetches its assets within its
+	// own pool.
+	//
+	// Deprecated: kept for compatibility, and will be removed.
+	ResPool sempool.Pool
+
+	resultsMu sync.Mutex   // guards Results, which each domain is appended to concurrently
+	linkPool  sempool.Pool // thread pool for checking external links, across all pages
+	links     *linkCache   // results of previous link checks
 }
 
 // CrawlerConfig is the configuration which changes Crawler
@@ -98,13 +139,25 @@ type CrawlerConfig struct {
 	Delay         time.Duration // delay before each resource is crawled
 	HTTPTimeout   time.Duration // http timeout before a request has become stale
 	Threads       int           // total number of threads to run crawls in
+	Spider        bool          // if same-host links within each page should be followed and fetched too
+	SpiderDepth   int           // how many links deep to follow when spidering (defaults to 1)
+	SpiderPages   int           // max number of pages to spider per domain, excluding the initial page (defaults to 10)
+	Sitemap       bool          // if pages should be sampled from the sitemaps of each domain (see robots.txt)
+	SitemapPages  int           // number of pages to sample from the sitemaps of each domain (defaults to 5)
+	RespectRobots bool          // if robots.txt Disallow rules should be honoured when spidering or sampling sitemaps
+	CheckLinks    bool          // if all <a href> links within each page should be checked
+	LinkThreads   int           // total number of threads to check external links in (defaults to 1)
+	LinkTimeout   time.Duration // http timeout when checking external links (defaults to HTTPTimeout)
+	Profiles      []*Profile    // request profiles (headers, auth, etc), applied in order to the requests they match
+	Proxy         *url.URL      // HTTP (CONNECT) or SOCKS5 proxy to send requests through, if any (see ParseProxy)
+	ProxyRules    []*ProxyRule  // rules choosing which requests are pinned, direct, or through Proxy
 }
 
 // fetchResource fetches a singular resource from a page, returning a *Resource struct.
 // As we don't care much about the body of the resource, that can safely be ignored. We
 // must still close the body object, however.
-func (c *Crawler) fetchResource(rsrc *Resource) {
-	defer c.ResPool.Free()
+func (c *Crawler) fetchResource(rsrc *Resource, pool sempool.Pool) {
+	defer pool.Free()
 	var err error
 
 	rsrc.URL = rsrc.Request.URL.String()
@@ -118,10 +171,23 @@ func (c *Crawler) fetchResource(rsrc *Resource) {
 	}
 
 	if resp.Body != nil {
-		// we don't care about the body, but we want to know how large it is.
-		// count the bytes but discard them.
+		var read int64
+
+		// stylesheets reference further assets (fonts, images, other
+		// stylesheets, etc), so they need to be parsed.
+		if rsrc.Kind == AssetStyle && resp.StatusCode == 200 {
+			if buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxStyleSize)); err == nil {
+				rsrc.links = getCSSSrc(string(buf), resp.URL)
+				read = int64(len(buf))
+			}
+		}
+
+		// we don't care about the rest of the body, but we want to know how
+		// large it is, and how long it takes to transfer. count the bytes
+		// but discard them.
+		n, _ := io.Copy(ioutil.Discard, resp.Body)
 		if resp.ContentLength < 1 {
-			resp.ContentLength, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.ContentLength = read + n
 		}
 
 		resp.Body.Close() // ensure the body stream is closed
@@ -134,7 +200,8 @@ func (c *Crawler) fetchResource(rsrc *Resource) {
 		Code:          resp.StatusCode,
 		ContentLength: resp.ContentLength,
 		Headers:       resp.Header,
-		TLS:           tlsToShort(resp.TLS),
+		TLS:           tlsToShort(resp.TLS, resp.URL.Host),
+		Timings:       resp.Timings(),
 	}
 
 	if rsrc.Response.URL.Host != rsrc.Request.URL.Host {
@@ -164,8 +231,9 @@ func (c *Crawler) Fetch(res *FetchResult) {
 
 	res.URL = res.Request.URL.String()
 
-	// actually fetch the request
-	resp, err := c.Get(res.Request.URL.String())
+	// actually fetch the request. additional pages (spidered, or from the
+	// sitemap) shouldn't redirect off of the hosts being scanned.
+	resp, err := c.get(res.Request.URL.String(), res.Source != "")
 	if err != nil {
 		res.Error = err
 		return
@@ -180,7 +248,7 @@ func (c *Crawler) Fetch(res *FetchResult) {
 		Code:          resp.StatusCode,
 		ContentLength: resp.ContentLength,
 		Headers:       resp.Header,
-		TLS:           tlsToShort(resp.TLS),
+		TLS:           tlsToShort(resp.TLS, resp.URL.Host),
 	}
 
 	if res.Response.URL.Host != res.Request.URL.Host {
@@ -195,6 +263,8 @@ func (c *Crawler) Fetch(res *FetchResult) {
 	res.Time = resp.Time
 
 	buf, _ := ioutil.ReadAll(resp.Body)
+	res.Response.Timings = resp.Timings()
+
 	b := ioutil.NopCloser(bytes.NewReader(buf))
 	defer b.Close()
 
@@ -217,39 +287,214 @@ func (c *Crawler) Fetch(res *FetchResult) {
 	}()
 
 	if c.Cnf.Assets {
-		urls := []*url.URL{}
+		seen := make(map[string]bool)
+
+		// assets are fetched a level at a time, as stylesheets can reference
+		// further assets (which may also be stylesheets), up to maxStyleDepth
+		// stylesheets deep.
+		links := getSrc(b, res.Response.URL)
+		for depth := 0; len(links) > 0 && depth <= maxStyleDepth; depth++ {
+			pool := sempool.New(4)
+			assets := c.fetchAssets(res, links, seen, pool)
+			pool.Wait()
+
+			links = nil
+			for _, asset := range assets {
+				links = append(links, asset.links...)
+			}
+		}
+	}
+
+	return
+}
+
+// fetchAssets concurrently fetches the assets referenced within res (or
+// one of its stylesheets) which haven't been seen yet, adding them to
+// res.Assets. The caller should wait on pool for them to complete.
+func (c *Crawler) fetchAssets(res *FetchResult, links []*assetLink, seen map[string]bool, pool sempool.Pool) (assets []*Resource) {
+	for _, link := range links {
+		if seen[link.URL] {
+			continue
+		}
+		seen[link.URL] = true
 
-		for _, uri := range getSrc(b, res.Response.URL) {
-			parsedURI, err := url.Parse(uri)
-			if err != nil {
-				c.Log.Printf("unable to parse asset uri [%s], resource: %s: %s", uri, res.Request, err)
+		uri, err := url.Parse(link.URL)
+		if err != nil {
+			c.Log.Printf("unable to parse asset uri [%s], resource: %s: %s", link.URL, res.Request, err)
+			continue
+		}
+
+		if c.Cnf.NoRemote {
+			if c.IsRemote(uri.Host) {
+				c.Log.Printf("host %s (url: %s) resolves to a unknown remote ip, skipping", uri.Host, uri)
 				continue
 			}
+		}
+
+		pool.Slot()
 
-			urls = append(urls, parsedURI)
+		asset := &Resource{Request: &Domain{URL: uri}, Kind: link.Kind, Mixed: mixedContent(res.Response.URL, uri, link.Kind)}
+		if asset.Mixed != "" {
+			c.Log.Printf("found %s mixed content on %s: %s", asset.Mixed, res.Response.URL, uri)
 		}
 
-		c.ResPool = sempool.New(4)
+		res.Assets = append(res.Assets, asset)
+		assets = append(assets, asset)
+		go c.fetchResource(asset, pool)
+	}
 
-		for i := range urls {
-			if c.Cnf.NoRemote {
-				if c.IsRemote(urls[i].Host) {
-					c.Log.Printf("host %s (url: %s) resolves to a unknown remote ip, skipping", urls[i].Host, urls[i])
-					continue
-				}
-			}
+	return assets
+}
+
+// fetchOrigin requests the origin webserver directly (bypassing the reverse
+// proxy), to determine which hop a failed request failed at.
+func (c *Crawler) fetchOrigin(origin *Domain) *Resource {
+	rsrc := &Resource{Request: origin, URL: origin.URL.String()}
+
+	resp, err := c.Get(rsrc.URL)
+	if err != nil {
+		rsrc.Error = err
+		return rsrc
+	}
+
+	if resp.Body != nil {
+		// read the body, so the transfer time is known.
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	rsrc.Response = Response{
+		URL:           resp.URL,
+		Code:          resp.StatusCode,
+		ContentLength: resp.ContentLength,
+		Headers:       resp.Header,
+		TLS:           tlsToShort(resp.TLS, resp.URL.Host),
+		Timings:       resp.Timings(),
+	}
+	rsrc.Time = resp.Time
+
+	c.Log.Printf("fetched origin %s in %dms with status %d", rsrc.Response.URL, rsrc.Time.Milli, rsrc.Response.Code)
+
+	return rsrc
+}
+
+// reSpiderSkip matches links which are very unlikely to be html pages, and
+// shouldn't be spidered.
+var reSpiderSkip = regexp.MustCompile(`(?i)\.(jpe?g|png|gif|svg|ico|webp|css|js|json|xml|txt|pdf|zip|gz|tgz|tar|rar|7z|exe|dmg|iso|mp[34]|avi|mov|webm|woff2?|ttf|eot)$`)
+
+// spiderLinks returns the links within page which haven't been seen yet,
+// are on host, and are allowed by robots (if any).
+func (c *Crawler) spiderLinks(page *FetchResult, host string, seen map[string]bool, robots *robotsTxt) (links []*url.URL) {
+	if page.Response.URL == nil || !strings.EqualFold(page.Response.URL.Host, host) {
+		return nil
+	}
+
+	if ctype := page.Response.Headers.Get("Content-Type"); ctype != "" && !strings.Contains(ctype, "html") {
+		return nil
+	}
+
+	for _, uri := range getLinks(strings.NewReader(page.Response.Body), page.Response.URL) {
+		if seen[uri] {
+			continue
+		}
+		seen[uri] = true
 
-			c.ResPool.Slot()
+		parsedURI, err := url.Parse(uri)
+		if err != nil {
+			c.Log.Printf("unable to parse link uri [%s], page: %s: %s", uri, page.Request, err)
+			continue
+		}
+
+		if reSpiderSkip.MatchString(parsedURI.Path) {
+			continue
+		}
 
-			asset := &Resource{Request: &Domain{URL: urls[i]}}
-			res.Assets = append(res.Assets, asset)
-			go c.fetchResource(res.Assets[len(res.Assets)-1])
+		if !c.allowedByRobots(robots, parsedURI) {
+			c.Log.Printf("skipping link %s, as it is disallowed by robots.txt", parsedURI)
+			continue
 		}
 
-		c.ResPool.Wait()
+		links = append(links, parsedURI)
 	}
 
-	return
+	return links
+}
+
+// fetchPage fetches uri as an additional page of res, adding it to
+// res.Pages. nil is returned if the page redirects off of the domain
+// (e.g. to a login provider), as it isn't a page we should be testing.
+func (c *Crawler) fetchPage(res *FetchResult, uri *url.URL, depth int, source string) *FetchResult {
+	if c.Cnf.Delay.String() != "0s" {
+		time.Sleep(c.Cnf.Delay)
+	}
+
+	page := &FetchResult{Depth: depth, Source: source}
+	page.Request = &Domain{URL: uri, IP: res.Request.IP, Meta: res.Request.Meta}
+
+	c.Fetch(page)
+
+	if isNotMatchOrigin(page.Error) {
+		c.Log.Printf("skipping %s page %s, as it redirects to a remote host", source, uri)
+		return nil
+	}
+
+	res.Pages = append(res.Pages, page)
+
+	return page
+}
+
+// spider follows the same-host links within res, breadth first, fetching
+// each linked page (and the pages those link to, up to Cnf.SpiderDepth links
+// deep), until Cnf.SpiderPages pages have been fetched. Fetched pages are
+// added to res.Pages.
+func (c *Crawler) spider(res *FetchResult, robots *robotsTxt) {
+	maxDepth, maxPages := c.Cnf.SpiderDepth, c.Cnf.SpiderPages
+	if maxDepth < 1 {
+		maxDepth = 1
+	}
+	if maxPages < 1 {
+		maxPages = 10
+	}
+
+	host := res.Response.URL.Host
+	seen := map[string]bool{res.Request.URL.String(): true, res.Response.URL.String(): true}
+	for _, page := range res.Pages {
+		// e.g. pages which were already sampled from the sitemap.
+		seen[page.Request.URL.String()] = true
+	}
+
+	type link struct {
+		uri   *url.URL
+		depth int
+	}
+
+	var queue []link
+	for _, uri := range c.spiderLinks(res, host, seen, robots) {
+		queue = append(queue, link{uri: uri, depth: 1})
+	}
+
+	var spidered int
+	for ; len(queue) > 0 && spidered < maxPages; queue = queue[1:] {
+		next := queue[0]
+
+		page := c.fetchPage(res, next.uri, next.depth, "link")
+		if page == nil {
+			continue
+		}
+		spidered++
+
+		if page.Error == nil && next.depth < maxDepth {
+			if page.Response.URL != nil {
+				seen[page.Response.URL.String()] = true
+			}
+
+			for _, uri := range c.spiderLinks(page, host, seen, robots) {
+				queue = append(queue, link{uri: uri, depth: next.depth + 1})
+			}
+		}
+	}
+
+	c.Log.Printf("spidered %d pages from %s", spidered, res.Request)
 }
 
 // Crawl represents the higher level functionality of scraper. Crawl should
@@ -269,6 +514,15 @@ func (c *Crawler) Crawl() {
 		dom = strings.TrimPrefix(c.Cnf.Domains[i].URL.Host, "www.")
 		c.ipmap[dom] = c.Cnf.Domains[i].IP        // no www. directive
 		c.ipmap["www."+dom] = c.Cnf.Domains[i].IP // www. directive
+
+		if origin := c.Cnf.Domains[i].Origin; origin != nil {
+			c.ipmap[origin.URL.Host] = origin.IP
+		}
+	}
+
+	if c.Cnf.CheckLinks {
+		c.linkPool = sempool.New(c.Cnf.LinkThreads)
+		c.links = &linkCache{links: make(map[string]*Link)}
 	}
 
 	// loop through all supplied urls and send them to a worker to be fetched
@@ -288,13 +542,47 @@ func (c *Crawler) Crawl() {
 			result.Request = domain
 
 			c.Fetch(result)
+
+			// if the request was through a reverse proxy and failed, request
+			// the origin directly to tell which of the two is failing.
+			if domain.Origin != nil && (result.Error != nil || result.Response.Code >= 500) {
+				result.Origin = c.fetchOrigin(domain.Origin)
+				c.Log.Printf("request to %s failed at the %s", domain, result.FailedHop())
+			}
 			// Check to see if there were errors here that we want to ignore.
-			if c.Cnf.NoRemote && result.Error == ErrNotMatchOrigin {
+			if c.Cnf.NoRemote && isNotMatchOrigin(result.Error) {
 				c.Log.Printf("skipping %s as skip remote was used (error: %s)", domain, result.Error)
 				return
 			}
 
+			if result.Error == nil && (c.Cnf.Spider || c.Cnf.Sitemap) {
+				var robots *robotsTxt
+				if c.Cnf.Sitemap || c.Cnf.RespectRobots {
+					robots = c.fetchRobots(result)
+				}
+
+				if c.Cnf.Sitemap {
+					c.sampleSitemap(result, robots)
+				}
+
+				if c.Cnf.Spider {
+					c.spider(result, robots)
+				}
+			}
+
+			if c.Cnf.CheckLinks && result.Error == nil {
+				c.checkLinks(result)
+
+				for _, page := range result.Pages {
+					if page.Error == nil {
+						c.checkLinks(page)
+					}
+				}
+			}
+
+			c.resultsMu.Lock()
 			c.Results = append(c.Results, result)
+			c.resultsMu.Unlock()
 
 			if result.Error != nil {
 				c.Log.Printf("error scanning %s (error: %s)", domain, result.Error)
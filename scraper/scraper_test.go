@@ -5,10 +5,15 @@
 package scraper
 
 import (
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 // GetResults gets the potential results of a given requested url/ip
@@ -95,3 +100,365 @@ func TestFetch(t *testing.T) {
 
 	return
 }
+
+func TestCrawlOrigin(t *testing.T) {
+	handler := func(code int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Host != "example.com:"+r.URL.Query().Get("port") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			w.WriteHeader(code)
+		})
+	}
+
+	proxy := httptest.NewServer(handler(http.StatusBadGateway))
+	defer proxy.Close()
+	okOrigin := httptest.NewServer(handler(http.StatusOK))
+	defer okOrigin.Close()
+	badOrigin := httptest.NewServer(handler(http.StatusInternalServerError))
+	defer badOrigin.Close()
+
+	domain := func(srv *httptest.Server, path string) *Domain {
+		uri, _ := url.Parse(srv.URL)
+		uri.Host = "example.com:" + uri.Port()
+		uri.Path = path
+		uri.RawQuery = "port=" + uri.Port()
+
+		return &Domain{URL: uri, IP: "127.0.0.1"}
+	}
+
+	cases := []struct {
+		origin *httptest.Server
+		path   string
+		want   string // wanted failed hop
+	}{
+		{origin: okOrigin, path: "/a", want: "proxy"},
+		{origin: badOrigin, path: "/b", want: "origin"},
+	}
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	for _, c := range cases {
+		dom := domain(proxy, c.path)
+		dom.Origin = domain(c.origin, c.path)
+		crawler.Cnf.Domains = append(crawler.Cnf.Domains, dom)
+	}
+	crawler.Cnf.Threads = 1
+	crawler.Crawl()
+
+	for _, c := range cases {
+		dom := domain(proxy, c.path)
+		res := GetResults(crawler, dom.URL.String(), dom.IP)
+		if res == nil {
+			t.Fatalf("GetResults(crawler, %q, %q) == nil, wanted results", dom.URL, dom.IP)
+		}
+
+		if res.Response.Code != http.StatusBadGateway {
+			t.Fatalf("Crawl of %q == %d, wanted %d", dom.URL, res.Response.Code, http.StatusBadGateway)
+		}
+
+		if hop := res.FailedHop(); hop != c.want {
+			t.Fatalf("FailedHop() of %q == %q, wanted %q", dom.URL, hop, c.want)
+		}
+	}
+
+	return
+}
+
+func TestCrawlRedirect(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		port := strings.TrimPrefix(srv.URL, "http://127.0.0.1:")
+
+		switch {
+		case r.Host == "example.com:"+port && r.URL.Path == "/":
+			http.Redirect(w, r, "http://www.example.com:"+port+"/", http.StatusMovedPermanently)
+		case r.Host == "example.com:"+port && r.URL.Path == "/ip":
+			http.Redirect(w, r, srv.URL+"/", http.StatusMovedPermanently)
+		case r.Host == "www.example.com:"+port:
+			w.Write([]byte("www"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		path    string
+		want    string // wanted host the request ended up at
+		wantErr bool
+	}{
+		{path: "/", want: "www.example.com"},
+		{path: "/ip", wantErr: true},
+	}
+
+	for _, c := range cases {
+		uri, _ := url.Parse(srv.URL)
+		uri.Host = "example.com:" + uri.Port()
+		uri.Path = c.path
+
+		crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+		crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+		crawler.Cnf.Threads = 1
+		crawler.Crawl()
+
+		res := GetResults(crawler, uri.String(), "127.0.0.1")
+		if res == nil {
+			t.Fatalf("GetResults(crawler, %q, %q) == nil, wanted results", uri, "127.0.0.1")
+		}
+
+		if c.wantErr {
+			if res.Error == nil {
+				t.Fatalf("Crawl of %q == %s, wanted error", uri, res)
+			}
+
+			continue
+		}
+
+		if res.Error != nil || res.Response.Code != http.StatusOK {
+			t.Fatalf("Crawl of %q == %s, wanted status %d", uri, res, http.StatusOK)
+		}
+
+		if host := res.Response.URL.Hostname(); host != c.want {
+			t.Fatalf("Crawl of %q ended up at %q, wanted %q", uri, host, c.want)
+		}
+	}
+
+	return
+}
+
+func TestCrawlSpider(t *testing.T) {
+	pages := map[string]string{
+		"/":  `<a href="/a">a</a> <a href="/b#top">b</a> <a href="/b">b</a> <a href="/logo.png">logo</a> <a href="http://other.com/">remote</a> <a href="/login">login</a>`,
+		"/a": `<a href="/">home</a> <a href="/c">c</a>`,
+		"/b": `<a href="/d">d</a>`,
+		"/c": `<a href="/e">e</a>`,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			// e.g. a login provider, which isn't a page of the domain.
+			http.Redirect(w, r, "http://sso.example.net/auth", http.StatusFound)
+			return
+		}
+
+		if r.URL.Path == "/b" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(pages[r.URL.Path]))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		depth int
+		pages int
+		want  string // wanted paths of spidered pages
+	}{
+		{depth: 1, pages: 10, want: "/a /b"},
+		{depth: 2, pages: 10, want: "/a /b /c /d"},
+		{depth: 3, pages: 10, want: "/a /b /c /d /e"},
+		{depth: 3, pages: 3, want: "/a /b /c"},
+		{depth: 0, pages: 0, want: "/a /b"},
+	}
+
+	for _, c := range cases {
+		uri, _ := url.Parse(srv.URL)
+		uri.Host = "example.com:" + uri.Port()
+		uri.Path = "/"
+
+		crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+		crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+		crawler.Cnf.Threads = 1
+		crawler.Cnf.Spider = true
+		crawler.Cnf.SpiderDepth = c.depth
+		crawler.Cnf.SpiderPages = c.pages
+		crawler.Crawl()
+
+		res := GetResults(crawler, uri.String(), "127.0.0.1")
+		if res == nil || res.Error != nil {
+			t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+		}
+
+		var paths []string
+		for _, page := range res.Pages {
+			if page.Error != nil {
+				t.Fatalf("spidered page %q returned error: %s", page.Request.URL, page.Error)
+			}
+
+			if page.Source != "link" {
+				t.Fatalf("spidered page %q has source %q, wanted %q", page.Request.URL, page.Source, "link")
+			}
+
+			if page.Request.IP != "127.0.0.1" {
+				t.Fatalf("spidered page %q requested through %q, wanted %q", page.Request.URL, page.Request.IP, "127.0.0.1")
+			}
+
+			if page.Request.URL.Path == "/b" && page.Response.Code != http.StatusInternalServerError {
+				t.Fatalf("spidered page %q == %d, wanted %d", page.Request.URL, page.Response.Code, http.StatusInternalServerError)
+			}
+
+			paths = append(paths, page.Request.URL.Path)
+		}
+
+		if out := strings.Join(paths, " "); out != c.want {
+			t.Fatalf("spider(depth: %d, pages: %d) == %q, wanted %q", c.depth, c.pages, out, c.want)
+		}
+	}
+
+	return
+}
+
+func TestFetchAssets(t *testing.T) {
+	files := map[string]string{
+		"/":             `<link rel="stylesheet" href="/css/main.css"><img src="/logo.png">`,
+		"/css/main.css": `@import "a.css"; @font-face { src: url(../fonts/x.woff); } body { background: url(../bg.png); }`,
+		"/css/a.css":    `@import "b.css"; .logo { background: url(/logo.png); }`,
+		"/css/b.css":    `@import url(c.css);`,
+		"/css/c.css":    `@import "main.css"; @import "d.css";`,
+		"/css/d.css":    `body { background: url(/never.png); }`,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			body = "asset"
+		}
+
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	uri.Host = "example.com:" + uri.Port()
+	uri.Path = "/"
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+	crawler.Cnf.Threads = 1
+	crawler.Cnf.Assets = true
+	crawler.Crawl()
+
+	res := GetResults(crawler, uri.String(), "127.0.0.1")
+	if res == nil || res.Error != nil {
+		t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+	}
+
+	want := map[string]string{
+		"/css/main.css": AssetStyle,
+		"/logo.png":     AssetImage,
+		"/css/a.css":    AssetStyle,
+		"/fonts/x.woff": AssetFont,
+		"/bg.png":       AssetImage,
+		"/css/b.css":    AssetStyle,
+		"/css/c.css":    AssetStyle,
+	}
+
+	for _, asset := range res.Assets {
+		if asset.Error != nil || asset.Response.Code != http.StatusOK {
+			t.Fatalf("asset %q == %s, wanted status %d", asset.Request.URL, asset, http.StatusOK)
+		}
+
+		kind, ok := want[asset.Request.URL.Path]
+		if !ok {
+			t.Fatalf("Fetch() fetched asset %q, which it shouldn't have", asset.Request.URL)
+		}
+
+		if asset.Kind != kind {
+			t.Fatalf("asset %q has kind %q, wanted %q", asset.Request.URL, asset.Kind, kind)
+		}
+
+		delete(want, asset.Request.URL.Path)
+	}
+
+	if len(want) > 0 {
+		t.Fatalf("Fetch() didn't fetch assets: %v", want)
+	}
+
+	return
+}
+
+func TestRequestWrap(t *testing.T) {
+	cl := &CustomClient{ipmap: map[string]string{
+		"example.com":      "1.2.3.4",
+		"example.com:8080": "1.2.3.4",
+		"example.net":      "2001:db8::1",
+		"example.net:8443": "2001:db8::1",
+		"xn--bcher-kva.de": "1.2.3.5",
+	}}
+
+	cases := []struct {
+		in   string
+		host string // wanted host header
+		dial string // wanted host the connection is made to
+	}{
+		{"http://example.com/", "example.com", "1.2.3.4"},
+		{"http://example.com:8080/", "example.com:8080", "1.2.3.4:8080"},
+		{"https://example.net/", "example.net", "[2001:db8::1]"},
+		{"https://example.net:8443/", "example.net:8443", "[2001:db8::1]:8443"},
+		{"http://[::1]:8080/", "[::1]:8080", "[::1]:8080"},
+		{"http://bücher.de/", "xn--bcher-kva.de", "1.2.3.5"},
+		{"http://xn--bcher-kva.de/", "xn--bcher-kva.de", "1.2.3.5"},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest("GET", c.in, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest(%q) returned error: %s", c.in, err)
+		}
+
+		cl.requestWrap(req)
+
+		if req.Host != c.host || req.URL.Host != c.dial {
+			t.Fatalf("requestWrap(%q) == (host: %q, dial: %q), wanted (host: %q, dial: %q)", c.in, req.Host, req.URL.Host, c.host, c.dial)
+		}
+	}
+
+	return
+}
+
+func TestFetchAssetsConcurrent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<img src="/a.png"><img src="/b.png"><img src="/c.png"><img src="/d.png"><img src="/e.png">`))
+			return
+		}
+
+		// slow assets, so the pages are fetched at the same time.
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("asset"))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	for _, host := range []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"} {
+		crawler.Cnf.Domains = append(crawler.Cnf.Domains, &Domain{URL: &url.URL{Scheme: "http", Host: host + ":" + uri.Port(), Path: "/"}, IP: "127.0.0.1"})
+	}
+	crawler.Cnf.Threads = 4
+	crawler.Cnf.Assets = true
+	crawler.Crawl()
+
+	for _, dom := range crawler.Cnf.Domains {
+		res := GetResults(crawler, dom.URL.String(), dom.IP)
+		if res == nil || res.Error != nil {
+			t.Fatalf("Crawl of %q == %v, wanted results", dom.URL, res)
+		}
+
+		if len(res.Assets) != 5 {
+			t.Fatalf("Crawl of %q fetched %d assets, wanted 5", dom.URL, len(res.Assets))
+		}
+
+		// each page should wait on its own assets to be fetched.
+		for _, asset := range res.Assets {
+			if asset.Error != nil || asset.Response.Code != http.StatusOK {
+				t.Fatalf("asset %q of %q == %s, wanted status %d", asset.Request.URL, dom.URL, asset, http.StatusOK)
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,341 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxSitemapSize is the max number of (uncompressed) bytes read from a
+	// robots.txt or sitemap file.
+	maxSitemapSize = 10 << 20
+	// maxSitemaps is the max number of sitemaps read for a single domain,
+	// including those referenced from sitemap indexes.
+	maxSitemaps = 10
+)
+
+// robotsRule is a single Allow/Disallow rule within robots.txt.
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsTxt represents the parts of a robots.txt file which apply to us:
+// the rules of the "User-agent: *" group, and the sitemaps it references.
+type robotsTxt struct {
+	sitemaps []string
+	rules    []*robotsRule
+}
+
+// parseRobots parses a robots.txt file. As we don't identify ourselves with
+// a user agent of our own, only the rules of the "*" group are used.
+func parseRobots(r io.Reader) *robotsTxt {
+	robots := &robotsTxt{}
+
+	// inGroup is true when the current group applies to "*", and inRules
+	// is true once the current group has started listing rules (which
+	// means the next User-agent line starts a new group).
+	var inGroup, inRules bool
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i > -1 {
+			line = line[:i]
+		}
+
+		i := strings.Index(line, ":")
+		if i < 1 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "sitemap":
+			if val != "" {
+				robots.sitemaps = append(robots.sitemaps, val)
+			}
+		case "user-agent":
+			if inRules {
+				inGroup, inRules = false, false
+			}
+
+			if val == "*" {
+				inGroup = true
+			}
+		case "allow", "disallow":
+			inRules = true
+
+			if !inGroup || val == "" {
+				// an empty Disallow allows everything.
+				continue
+			}
+
+			robots.rules = append(robots.rules, &robotsRule{
+				allow:   key == "allow",
+				pattern: val,
+				re:      robotsPattern(val),
+			})
+		}
+	}
+
+	return robots
+}
+
+// robotsPattern converts a robots.txt path pattern (which may contain "*"
+// wildcards, and be anchored to the end of the path with "$") to a regexp.
+func robotsPattern(pattern string) *regexp.Regexp {
+	var anchored bool
+	if strings.HasSuffix(pattern, "$") {
+		pattern = strings.TrimSuffix(pattern, "$")
+		anchored = true
+	}
+
+	expr := "^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1)
+	if anchored {
+		expr += "$"
+	}
+
+	return regexp.MustCompile(expr)
+}
+
+// Allowed returns true if uri isn't disallowed by the robots.txt rules. The
+// longest (most specific) matching rule wins, with Allow rules winning ties.
+func (r *robotsTxt) Allowed(uri *url.URL) bool {
+	if r == nil {
+		return true
+	}
+
+	path := uri.RequestURI()
+
+	var match *robotsRule
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+
+		if match == nil || len(rule.pattern) > len(match.pattern) || (len(rule.pattern) == len(match.pattern) && rule.allow) {
+			match = rule
+		}
+	}
+
+	return match == nil || match.allow
+}
+
+// allowedByRobots returns false if uri is disallowed by robots, and the
+// crawler has been configured to honour robots.txt.
+func (c *Crawler) allowedByRobots(robots *robotsTxt, uri *url.URL) bool {
+	return !c.Cnf.RespectRobots || robots.Allowed(uri)
+}
+
+// sitemapXML represents both sitemap <urlset>'s and <sitemapindex>'s.
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// parseSitemap parses a (possibly gzipped) sitemap, returning the page urls
+// within it if it's a <urlset>, or the sitemap urls within it if it's a
+// <sitemapindex>.
+func parseSitemap(b []byte) (urls, sitemaps []string, err error) {
+	if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+
+		if b, err = ioutil.ReadAll(io.LimitReader(gz, maxSitemapSize)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var sitemap sitemapXML
+	if err = xml.Unmarshal(b, &sitemap); err != nil {
+		return nil, nil, err
+	}
+
+	switch sitemap.XMLName.Local {
+	case "urlset", "sitemapindex":
+	default:
+		return nil, nil, fmt.Errorf("unknown sitemap type <%s>", sitemap.XMLName.Local)
+	}
+
+	for _, uri := range sitemap.URLs {
+		urls = append(urls, strings.TrimSpace(uri))
+	}
+
+	for _, uri := range sitemap.Sitemaps {
+		sitemaps = append(sitemaps, strings.TrimSpace(uri))
+	}
+
+	return urls, sitemaps, nil
+}
+
+// fetchFile fetches uri (through the same IP pinning as any other request),
+// returning the body if it was successful.
+func (c *Crawler) fetchFile(uri string) ([]byte, error) {
+	resp, err := c.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Body == nil {
+		return nil, fmt.Errorf("%s returned an empty response", uri)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s returned status code %d", uri, resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxSitemapSize))
+}
+
+// fetchRobots fetches and parses the robots.txt of the domain res is on. nil
+// is returned if the domain doesn't have one.
+func (c *Crawler) fetchRobots(res *FetchResult) *robotsTxt {
+	uri := &url.URL{Scheme: res.Response.URL.Scheme, Host: res.Response.URL.Host, Path: "/robots.txt"}
+
+	body, err := c.fetchFile(uri.String())
+	if err != nil {
+		c.Log.Printf("unable to fetch robots.txt for %s: %s", res.Request, err)
+		return nil
+	}
+
+	robots := parseRobots(bytes.NewReader(body))
+	c.Log.Printf("read %s: %d rules, %d sitemaps", uri, len(robots.rules), len(robots.sitemaps))
+
+	return robots
+}
+
+// sitemapURLs reads the sitemaps referenced in robots (or /sitemap.xml if
+// there are none), following sitemap indexes, and returns all page urls on
+// the same host as res.
+func (c *Crawler) sitemapURLs(res *FetchResult, robots *robotsTxt) (urls []*url.URL) {
+	host := res.Response.URL.Host
+
+	var queue []string
+	if robots != nil {
+		queue = append(queue, robots.sitemaps...)
+	}
+	if len(queue) == 0 {
+		queue = append(queue, (&url.URL{Scheme: res.Response.URL.Scheme, Host: host, Path: "/sitemap.xml"}).String())
+	}
+
+	seen := make(map[string]bool)
+	for read := 0; len(queue) > 0 && read < maxSitemaps; queue = queue[1:] {
+		sitemap, err := url.Parse(queue[0])
+		if err != nil || seen[sitemap.String()] {
+			continue
+		}
+		seen[sitemap.String()] = true
+
+		if !strings.EqualFold(sitemap.Host, host) {
+			// we'd be unable to pin the request to the ip of the domain.
+			c.Log.Printf("skipping sitemap %s, as it isn't on %s", sitemap, host)
+			continue
+		}
+
+		read++
+		body, err := c.fetchFile(sitemap.String())
+		if err != nil {
+			c.Log.Printf("unable to fetch sitemap for %s: %s", res.Request, err)
+			continue
+		}
+
+		pages, sitemaps, err := parseSitemap(body)
+		if err != nil {
+			c.Log.Printf("unable to parse sitemap %s: %s", sitemap, err)
+			continue
+		}
+
+		c.Log.Printf("read sitemap %s: %d pages, %d sitemaps", sitemap, len(pages), len(sitemaps))
+		queue = append(queue, sitemaps...)
+
+		for _, page := range pages {
+			uri, err := url.Parse(page)
+			if err != nil || (uri.Scheme != "http" && uri.Scheme != "https") || !strings.EqualFold(uri.Host, host) {
+				continue
+			}
+
+			uri.Fragment = ""
+			if len(uri.Path) == 0 {
+				uri.Path = "/"
+			}
+
+			if seen[uri.String()] {
+				continue
+			}
+			seen[uri.String()] = true
+
+			urls = append(urls, uri)
+		}
+	}
+
+	return urls
+}
+
+// samplePages returns n urls, evenly spread across urls (which are usually
+// grouped by section within sitemaps), so the sample covers as much of the
+// site as possible.
+func samplePages(urls []*url.URL, n int) []*url.URL {
+	if n >= len(urls) {
+		return urls
+	}
+
+	sample := make([]*url.URL, n)
+	for i := 0; i < n; i++ {
+		sample[i] = urls[i*len(urls)/n]
+	}
+
+	return sample
+}
+
+// sampleSitemap fetches Cnf.SitemapPages pages sampled from the sitemaps of
+// the domain res is on, adding them to res.Pages.
+func (c *Crawler) sampleSitemap(res *FetchResult, robots *robotsTxt) {
+	n := c.Cnf.SitemapPages
+	if n < 1 {
+		n = 5
+	}
+
+	var urls []*url.URL
+	for _, uri := range c.sitemapURLs(res, robots) {
+		if uri.String() == res.Request.URL.String() || uri.String() == res.Response.URL.String() {
+			continue
+		}
+
+		if !c.allowedByRobots(robots, uri) {
+			c.Log.Printf("skipping sitemap page %s, as it is disallowed by robots.txt", uri)
+			continue
+		}
+
+		urls = append(urls, uri)
+	}
+
+	var sampled int
+	for _, uri := range samplePages(urls, n) {
+		if c.fetchPage(res, uri, 1, "sitemap") != nil {
+			sampled++
+		}
+	}
+
+	c.Log.Printf("sampled %d pages (of %d) from the sitemaps of %s", sampled, len(urls), res.Request)
+}
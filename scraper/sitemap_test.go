@@ -0,0 +1,250 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/lrstanley/marill/utils"
+)
+
+func TestParseRobots(t *testing.T) {
+	robots := parseRobots(strings.NewReader(`# example robots.txt
+User-agent: Googlebot
+Disallow: /
+
+User-agent: bingbot
+User-agent: *
+Disallow: /wp-admin/
+Allow: /wp-admin/admin-ajax.php
+Disallow: /*.pdf$
+Disallow: /search # trailing comment
+Disallow:
+
+User-agent: other
+Disallow: /other
+
+Sitemap: http://example.com/sitemap_index.xml
+sitemap: http://example.com/news.xml.gz
+`))
+
+	sitemaps := "http://example.com/sitemap_index.xml http://example.com/news.xml.gz"
+	if out := strings.Join(robots.sitemaps, " "); out != sitemaps {
+		t.Fatalf("parseRobots().sitemaps == %q, wanted %q", out, sitemaps)
+	}
+
+	cases := []struct {
+		in   string
+		want bool
+	}{
+		{"/", true},
+		{"/about", true},
+		{"/wp-admin/", false},
+		{"/wp-admin/options.php", false},
+		{"/wp-admin/admin-ajax.php", true},
+		{"/files/report.pdf", false},
+		{"/files/report.pdf?download=1", true},
+		{"/search", false},
+		{"/search?q=test", false},
+		{"/searching", false},
+		{"/other", true},
+	}
+
+	for _, c := range cases {
+		uri := utils.MustURL("http://example.com"+c.in, "")
+
+		if out := robots.Allowed(uri); out != c.want {
+			t.Fatalf("robots.Allowed(%q) == %t, wanted %t", c.in, out, c.want)
+		}
+	}
+
+	var empty *robotsTxt
+	if !empty.Allowed(utils.MustURL("http://example.com/", "")) {
+		t.Fatalf("robots.Allowed() == false without a robots.txt, wanted true")
+	}
+
+	return
+}
+
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(b)
+	gz.Close()
+
+	return buf.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	urlset := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>http://example.com/</loc><priority>1.0</priority></url>
+	<url><loc>
+		http://example.com/about
+	</loc></url>
+</urlset>`)
+	index := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>http://example.com/pages.xml</loc></sitemap>
+	<sitemap><loc>http://example.com/posts.xml.gz</loc></sitemap>
+</sitemapindex>`)
+
+	cases := []struct {
+		in       []byte
+		urls     string
+		sitemaps string
+		wantErr  bool
+	}{
+		{in: urlset, urls: "http://example.com/ http://example.com/about"},
+		{in: gzipBytes(urlset), urls: "http://example.com/ http://example.com/about"},
+		{in: index, sitemaps: "http://example.com/pages.xml http://example.com/posts.xml.gz"},
+		{in: []byte(`<html><body>not found</body></html>`), wantErr: true},
+		{in: []byte(`not xml`), wantErr: true},
+		{in: []byte{0x1f, 0x8b, 0x00}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		urls, sitemaps, err := parseSitemap(c.in)
+		if err != nil {
+			if !c.wantErr {
+				t.Fatalf("parseSitemap(%q) returned error: %s", c.in, err)
+			}
+
+			continue
+		}
+
+		if c.wantErr {
+			t.Fatalf("parseSitemap(%q) == %q, wanted error", c.in, urls)
+		}
+
+		if strings.Join(urls, " ") != c.urls || strings.Join(sitemaps, " ") != c.sitemaps {
+			t.Fatalf("parseSitemap(%q) == (%q, %q), wanted (%q, %q)", c.in, urls, sitemaps, c.urls, c.sitemaps)
+		}
+	}
+
+	return
+}
+
+func TestSamplePages(t *testing.T) {
+	var urls []*url.URL
+	for i := 0; i < 10; i++ {
+		urls = append(urls, utils.MustURL(fmt.Sprintf("http://example.com/%d", i), ""))
+	}
+
+	cases := []struct {
+		n    int
+		want string
+	}{
+		{1, "/0"},
+		{2, "/0 /5"},
+		{3, "/0 /3 /6"},
+		{5, "/0 /2 /4 /6 /8"},
+		{10, "/0 /1 /2 /3 /4 /5 /6 /7 /8 /9"},
+		{20, "/0 /1 /2 /3 /4 /5 /6 /7 /8 /9"},
+	}
+
+	for _, c := range cases {
+		var paths []string
+		for _, uri := range samplePages(urls, c.n) {
+			paths = append(paths, uri.Path)
+		}
+
+		if out := strings.Join(paths, " "); out != c.want {
+			t.Fatalf("samplePages(urls, %d) == %q, wanted %q", c.n, out, c.want)
+		}
+	}
+
+	return
+}
+
+func TestCrawlSitemap(t *testing.T) {
+	var host string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != host {
+			// the request wasn't pinned to the ip of the domain.
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private/\n\nSitemap: http://%s/sitemap_index.xml\nSitemap: http://other.com/sitemap.xml\n", host)
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>http://%[1]s/pages.xml.gz</loc></sitemap><sitemap><loc>http://%[1]s/missing.xml</loc></sitemap></sitemapindex>`, host)
+		case "/pages.xml.gz":
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(gzipBytes([]byte(fmt.Sprintf(`<urlset>
+				<url><loc>http://%[1]s/</loc></url>
+				<url><loc>http://%[1]s/a</loc></url>
+				<url><loc>http://%[1]s/private/b</loc></url>
+				<url><loc>http://%[1]s/c</loc></url>
+				<url><loc>http://other.com/d</loc></url>
+			</urlset>`, host))))
+		case "/", "/a", "/private/b", "/c":
+			fmt.Fprintf(w, "<html><body>%s</body></html>", r.URL.Path)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		robots bool
+		pages  int
+		want   string // wanted paths of sampled pages
+	}{
+		{robots: false, pages: 10, want: "/a /private/b /c"},
+		{robots: true, pages: 10, want: "/a /c"},
+		{robots: false, pages: 2, want: "/a /private/b"},
+	}
+
+	for _, c := range cases {
+		uri, _ := url.Parse(srv.URL)
+		uri.Host = "example.com:" + uri.Port()
+		uri.Path = "/"
+		host = uri.Host
+
+		crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+		crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+		crawler.Cnf.Threads = 1
+		crawler.Cnf.Sitemap = true
+		crawler.Cnf.SitemapPages = c.pages
+		crawler.Cnf.RespectRobots = c.robots
+		crawler.Crawl()
+
+		res := GetResults(crawler, uri.String(), "127.0.0.1")
+		if res == nil || res.Error != nil {
+			t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+		}
+
+		var paths []string
+		for _, page := range res.Pages {
+			if page.Error != nil || page.Response.Code != http.StatusOK {
+				t.Fatalf("sampled page %q == %s, wanted status %d", page.Request.URL, page, http.StatusOK)
+			}
+
+			if page.Source != "sitemap" {
+				t.Fatalf("sampled page %q has source %q, wanted %q", page.Request.URL, page.Source, "sitemap")
+			}
+
+			paths = append(paths, page.Request.URL.Path)
+		}
+
+		if out := strings.Join(paths, " "); out != c.want {
+			t.Fatalf("sampleSitemap(robots: %t, pages: %d) == %q, wanted %q", c.robots, c.pages, out, c.want)
+		}
+	}
+
+	return
+}
@@ -5,9 +5,12 @@
 package scraper
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"fmt"
+	"math"
 	"net"
 	"strings"
 	"time"
@@ -18,8 +21,49 @@ type TLSResponse struct {
 	HandshakeComplete bool
 	PeerCertificates  []*ResponseCert
 	VerifiedChains    [][]*ResponseCert
+
+	Version            string // Version is the negotiated protocol version (e.g. "TLS 1.2")
+	CipherSuite        string // CipherSuite is the name of the negotiated cipher suite
+	NegotiatedProtocol string // NegotiatedProtocol is the protocol negotiated with ALPN (e.g. "h2"), if any
+	OCSPStapled        bool   // OCSPStapled is true if the server stapled an OCSP response
+	SCTs               int    // SCTs is the number of signed certificate timestamps sent by the server
+
+	DaysLeft      int    // DaysLeft is the number of days until the certificate expires (negative if it has expired)
+	ChainComplete bool   // ChainComplete is true if the certificates sent by the server chain up to a trusted root
+	ChainStatus   string // ChainStatus is why the chain is (or isn't) trusted, see the Chain* constants
+	ChainError    string // ChainError is why the chain couldn't be verified, if it couldn't
+	HostnameMatch bool   // HostnameMatch is true if the certificate is valid for the hostname
+}
+
+// Statuses of the certificate chain sent by a server (see
+// TLSResponse.ChainStatus).
+const (
+	// ChainComplete is a chain which goes up to a trusted root.
+	ChainComplete = "complete"
+	// ChainIncomplete is a chain which is missing an intermediate, which
+	// the server should have sent.
+	ChainIncomplete = "incomplete"
+	// ChainUntrusted is a self-signed certificate, or a chain which goes up
+	// to an unknown (e.g. private) certificate authority.
+	ChainUntrusted = "untrusted"
+	// ChainInvalid is a chain which can't be verified for any other reason,
+	// e.g. an expired intermediate.
+	ChainInvalid = "invalid"
+)
+
+// tlsVersions are the names of each TLS/SSL protocol version.
+var tlsVersions = map[uint16]string{
+	tls.VersionSSL30: "SSL 3.0",
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
 }
 
+// tlsRoots are the root certificates chains are verified against. nil uses
+// the roots of the system.
+var tlsRoots *x509.CertPool
+
 type ResponseCert struct {
 	Version        int
 	NotBefore      time.Time
@@ -40,15 +84,41 @@ type CertName struct {
 	CommonName    string
 }
 
-func tlsToShort(data *tls.ConnectionState) *TLSResponse {
+// tlsToShort converts the TLS session of a request to host into a
+// TLSResponse, verifying the certificate chain and hostname along the way.
+func tlsToShort(data *tls.ConnectionState, host string) *TLSResponse {
 	if data == nil {
 		return nil
 	}
 
 	ssl := &TLSResponse{
-		HandshakeComplete: data.HandshakeComplete,
-		PeerCertificates:  make([]*ResponseCert, len(data.PeerCertificates)),
-		VerifiedChains:    make([][]*ResponseCert, len(data.VerifiedChains)),
+		HandshakeComplete:  data.HandshakeComplete,
+		PeerCertificates:   make([]*ResponseCert, len(data.PeerCertificates)),
+		VerifiedChains:     make([][]*ResponseCert, len(data.VerifiedChains)),
+		Version:            tlsVersions[data.Version],
+		CipherSuite:        tls.CipherSuiteName(data.CipherSuite),
+		NegotiatedProtocol: data.NegotiatedProtocol,
+		OCSPStapled:        len(data.OCSPResponse) > 0,
+		SCTs:               len(data.SignedCertificateTimestamps),
+	}
+
+	if ssl.Version == "" {
+		ssl.Version = fmt.Sprintf("unknown (0x%04x)", data.Version)
+	}
+
+	if len(data.PeerCertificates) > 0 {
+		leaf := data.PeerCertificates[0]
+
+		ssl.DaysLeft = int(math.Floor(time.Until(leaf.NotAfter).Hours() / 24))
+		ssl.HostnameMatch = VerifyHostname(data, host) == nil
+
+		err := verifyChain(data.PeerCertificates)
+		if err != nil {
+			ssl.ChainError = err.Error()
+		}
+
+		ssl.ChainStatus = chainStatus(data.PeerCertificates, err)
+		ssl.ChainComplete = ssl.ChainStatus == ChainComplete
 	}
 
 	// loop through the peer certs first
@@ -68,6 +138,27 @@ func tlsToShort(data *tls.ConnectionState) *TLSResponse {
 	return ssl
 }
 
+// verifyChain verifies that the leaf certificate (the first of certs) chains
+// up to a trusted root, using only the intermediates sent by the server.
+// Expiry of the leaf is ignored, as it's checked separately.
+func verifyChain(certs []*x509.Certificate) error {
+	opts := x509.VerifyOptions{
+		Roots:         tlsRoots,
+		Intermediates: x509.NewCertPool(),
+	}
+
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	if now := time.Now(); now.After(certs[0].NotAfter) {
+		opts.CurrentTime = certs[0].NotAfter
+	}
+
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
 func tlsCertToShort(data *x509.Certificate) *ResponseCert {
 	if data == nil {
 		return nil
@@ -112,3 +203,30 @@ func tlsNameToShort(data pkix.Name) *CertName {
 
 	return name
 }
+
+// chainStatus returns the status of the chain certs, given the error from
+// verifyChain.
+func chainStatus(certs []*x509.Certificate, err error) string {
+	if err == nil {
+		return ChainComplete
+	}
+
+	if _, ok := err.(x509.UnknownAuthorityError); !ok {
+		return ChainInvalid
+	}
+
+	// the chain ends at a root (or self-signed leaf) which isn't trusted.
+	last := certs[len(certs)-1]
+	if bytes.Equal(last.RawIssuer, last.RawSubject) && last.CheckSignatureFrom(last) == nil {
+		return ChainUntrusted
+	}
+
+	// the issuer of the last certificate wasn't sent. public certificate
+	// authorities say where to fetch it from, so it's a missing
+	// intermediate. otherwise, it's likely a private certificate authority.
+	if len(last.IssuingCertificateURL) > 0 {
+		return ChainIncomplete
+	}
+
+	return ChainUntrusted
+}
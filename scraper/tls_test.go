@@ -0,0 +1,213 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTLSToShort(t *testing.T) {
+	cases := []struct {
+		host       string // host the request is made to
+		maxVersion uint16 // max version the server supports
+		trusted    bool   // if the certificate of the server is trusted
+		version    string // wanted TLSResponse.Version
+		chain      string // wanted TLSResponse.ChainStatus
+		hostname   bool   // wanted TLSResponse.HostnameMatch
+	}{
+		{host: "example.com", trusted: true, version: "TLS 1.3", chain: ChainComplete, hostname: true},
+		{host: "example.com", maxVersion: tls.VersionTLS12, trusted: true, version: "TLS 1.2", chain: ChainComplete, hostname: true},
+		{host: "example.com", maxVersion: tls.VersionTLS10, trusted: true, version: "TLS 1.0", chain: ChainComplete, hostname: true},
+		// self-signed.
+		{host: "example.com", trusted: false, version: "TLS 1.3", chain: ChainUntrusted, hostname: true},
+		{host: "example.org", trusted: true, version: "TLS 1.3", chain: ChainComplete, hostname: false},
+	}
+
+	defer func() { tlsRoots = nil }()
+
+	for _, c := range cases {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: c.maxVersion}
+		srv.StartTLS()
+
+		tlsRoots = nil
+		if c.trusted {
+			tlsRoots = x509.NewCertPool()
+			tlsRoots.AddCert(srv.Certificate())
+		}
+
+		uri, _ := url.Parse(srv.URL)
+		uri.Host = c.host + ":" + uri.Port()
+		uri.Path = "/"
+
+		crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+		crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+		crawler.Cnf.Threads = 1
+		crawler.Cnf.AllowInsecure = true
+		crawler.Crawl()
+		srv.Close()
+
+		res := GetResults(crawler, uri.String(), "127.0.0.1")
+		if res == nil || res.Error != nil {
+			t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+		}
+
+		ssl := res.Response.TLS
+		if ssl == nil || len(ssl.PeerCertificates) == 0 {
+			t.Fatalf("Crawl of %q has TLS %+v, wanted certificates", uri, ssl)
+		}
+
+		if ssl.Version != c.version || ssl.ChainStatus != c.chain || ssl.ChainComplete != (c.chain == ChainComplete) || ssl.HostnameMatch != c.hostname {
+			t.Fatalf("Crawl of %q has TLS (version: %q, chain: %q, hostname: %t), wanted (%q, %q, %t)", uri, ssl.Version, ssl.ChainStatus, ssl.HostnameMatch, c.version, c.chain, c.hostname)
+		}
+
+		if ssl.CipherSuite == "" || ssl.DaysLeft < 1 {
+			t.Fatalf("Crawl of %q has TLS (cipher: %q, days left: %d), wanted a cipher and expiry", uri, ssl.CipherSuite, ssl.DaysLeft)
+		}
+	}
+
+	return
+}
+
+func TestServerName(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		mu.Lock()
+		names = append(names, hello.ServerName)
+		mu.Unlock()
+
+		return nil, nil
+	}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the server listens on a random (non-standard) port.
+	uri, _ := url.Parse(srv.URL)
+	uri.Host = "example.com:" + uri.Port()
+	uri.Path = "/"
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+	crawler.Cnf.Threads = 1
+	crawler.Cnf.AllowInsecure = true
+	crawler.Crawl()
+
+	if res := GetResults(crawler, uri.String(), "127.0.0.1"); res == nil || res.Error != nil {
+		t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(names) == 0 {
+		t.Fatalf("Crawl of %q made no tls handshakes", uri)
+	}
+
+	for _, name := range names {
+		if name != "example.com" {
+			t.Fatalf("Crawl of %q sent server name %q, wanted %q", uri, name, "example.com")
+		}
+	}
+
+	return
+}
+
+// newTestCert creates a certificate for name, signed by parent (or self-signed,
+// if parent is nil).
+func newTestCert(t *testing.T, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, expired bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  ca,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:              []string{name},
+	}
+
+	if expired {
+		tmpl.NotAfter = time.Now().Add(-24 * time.Hour)
+	}
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	} else {
+		// where public certificate authorities say the issuer can be fetched from.
+		tmpl.IssuingCertificateURL = []string{"http://ca.example.com/" + parent.Subject.CommonName + ".crt"}
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+
+	cert, _ := x509.ParseCertificate(raw)
+	return cert, key
+}
+
+func TestChainStatus(t *testing.T) {
+	root, rootKey := newTestCert(t, "Root CA", true, nil, nil, false)
+	inter, interKey := newTestCert(t, "Intermediate CA", true, root, rootKey, false)
+	leaf, _ := newTestCert(t, "example.com", false, inter, interKey, false)
+
+	expiredInter, expiredInterKey := newTestCert(t, "Expired CA", true, root, rootKey, true)
+	expiredLeaf, _ := newTestCert(t, "example.com", false, expiredInter, expiredInterKey, false)
+
+	selfSigned, _ := newTestCert(t, "example.com", false, nil, nil, false)
+
+	// a private certificate authority, which doesn't say where its
+	// certificate can be fetched from.
+	privRoot, privRootKey := newTestCert(t, "Private CA", true, nil, nil, false)
+	privLeaf, _ := newTestCert(t, "example.com", false, privRoot, privRootKey, false)
+	privLeaf.IssuingCertificateURL = nil
+
+	cases := []struct {
+		name  string
+		certs []*x509.Certificate
+		want  string
+	}{
+		{"complete", []*x509.Certificate{leaf, inter}, ChainComplete},
+		{"missing intermediate", []*x509.Certificate{leaf}, ChainIncomplete},
+		{"self-signed", []*x509.Certificate{selfSigned}, ChainUntrusted},
+		{"private root sent", []*x509.Certificate{privLeaf, privRoot}, ChainUntrusted},
+		{"private root not sent", []*x509.Certificate{privLeaf}, ChainUntrusted},
+		{"expired intermediate", []*x509.Certificate{expiredLeaf, expiredInter}, ChainInvalid},
+	}
+
+	defer func() { tlsRoots = nil }()
+	tlsRoots = x509.NewCertPool()
+	tlsRoots.AddCert(root)
+
+	for _, c := range cases {
+		if status := chainStatus(c.certs, verifyChain(c.certs)); status != c.want {
+			t.Fatalf("chainStatus(%s) == %q, wanted %q", c.name, status, c.want)
+		}
+	}
+
+	return
+}
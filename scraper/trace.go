@@ -0,0 +1,98 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings are the durations (in milliseconds) of each phase of a request.
+// Phases which didn't happen are 0, e.g. DNS when the request is pinned to
+// an ip, or TLS over http. For redirected requests, they are the timings of
+// the final request.
+type Timings struct {
+	DNS      int64 // DNS is the time it took to resolve the hostname
+	Connect  int64 // Connect is the time it took to establish the TCP connection
+	TLS      int64 // TLS is the time it took to complete the TLS handshake
+	TTFB     int64 // TTFB (time to first byte) is the time between sending the request, and the first byte of the response
+	Transfer int64 // Transfer is the time it took to read the response body
+}
+
+// traceTimes are when each phase of a request started and ended.
+type traceTimes struct {
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+	bodyDone                  time.Time
+}
+
+// requestTrace records when each phase of a request started and ended,
+// using net/http/httptrace.
+type requestTrace struct {
+	sync.Mutex
+	times traceTimes
+}
+
+// clientTrace returns the httptrace hooks which record into t.
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	set := func(field *time.Time) {
+		t.Lock()
+		*field = time.Now()
+		t.Unlock()
+	}
+
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			// a new request (e.g. following a redirect), so forget about
+			// the previous one.
+			t.Lock()
+			t.times = traceTimes{}
+			t.Unlock()
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&t.times.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&t.times.dnsDone) },
+		ConnectStart:         func(string, string) { set(&t.times.connectStart) },
+		ConnectDone:          func(string, string, error) { set(&t.times.connectDone) },
+		TLSHandshakeStart:    func() { set(&t.times.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&t.times.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&t.times.wroteRequest) },
+		GotFirstResponseByte: func() { set(&t.times.firstByte) },
+	}
+}
+
+// done marks the response body as completely read.
+func (t *requestTrace) done() {
+	t.Lock()
+	t.times.bodyDone = time.Now()
+	t.Unlock()
+}
+
+// since returns the milliseconds between start and end, or 0 if either
+// didn't happen.
+func since(start, end time.Time) int64 {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+
+	return int64(end.Sub(start) / time.Millisecond)
+}
+
+// Timings returns the timings of each phase of the request.
+func (t *requestTrace) Timings() *Timings {
+	t.Lock()
+	defer t.Unlock()
+
+	return &Timings{
+		DNS:      since(t.times.dnsStart, t.times.dnsDone),
+		Connect:  since(t.times.connectStart, t.times.connectDone),
+		TLS:      since(t.times.tlsStart, t.times.tlsDone),
+		TTFB:     since(t.times.wroteRequest, t.times.firstByte),
+		Transfer: since(t.times.firstByte, t.times.bodyDone),
+	}
+}
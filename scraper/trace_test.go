@@ -0,0 +1,93 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package scraper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	delay := 50 * time.Millisecond
+
+	var host string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != host {
+			// the request wasn't pinned to the ip of the domain.
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/":
+			// slow to respond, and slow to send the rest of the body.
+			time.Sleep(delay)
+			fmt.Fprint(w, `<html><head><script src="/app.js"></script></head><body>`)
+			w.(http.Flusher).Flush()
+
+			time.Sleep(delay)
+			fmt.Fprint(w, `</body></html>`)
+		case "/app.js":
+			// with a known length, which the body should still be read for.
+			w.Header().Set("Content-Length", "20")
+			time.Sleep(delay)
+			fmt.Fprint(w, "var a = 1;")
+			w.(http.Flusher).Flush()
+
+			time.Sleep(delay)
+			fmt.Fprint(w, "var b = 2;")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	uri.Host = "example.com:" + uri.Port()
+	uri.Path = "/"
+	host = uri.Host
+
+	crawler := &Crawler{Log: log.New(ioutil.Discard, "", 0)}
+	crawler.Cnf.Domains = []*Domain{{URL: uri, IP: "127.0.0.1"}}
+	crawler.Cnf.Threads = 1
+	crawler.Cnf.Assets = true
+	crawler.Crawl()
+
+	res := GetResults(crawler, uri.String(), "127.0.0.1")
+	if res == nil || res.Error != nil {
+		t.Fatalf("Crawl of %q == %v, wanted results", uri, res)
+	}
+
+	min := int64(delay / time.Millisecond)
+
+	timings := res.Response.Timings
+	if timings == nil {
+		t.Fatalf("Crawl of %q has no timings", uri)
+	}
+
+	if timings.TTFB < min || timings.Transfer < min {
+		t.Fatalf("Crawl of %q has timings %+v, wanted TTFB and Transfer >= %d", uri, timings, min)
+	}
+
+	if timings.DNS != 0 || timings.TLS != 0 {
+		t.Fatalf("Crawl of %q has timings %+v, wanted no DNS or TLS time", uri, timings)
+	}
+
+	if len(res.Assets) != 1 {
+		t.Fatalf("Crawl of %q has %d assets, wanted 1", uri, len(res.Assets))
+	}
+
+	if timings = res.Assets[0].Response.Timings; timings == nil || timings.TTFB < min || timings.Transfer < min {
+		t.Fatalf("asset %q has timings %+v, wanted TTFB and Transfer >= %d", res.Assets[0].URL, timings, min)
+	}
+
+	return
+}
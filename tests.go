@@ -28,19 +28,48 @@ const (
 )
 
 var defaultTestTypes = [...]string{
-	"url",           // resource url (https://example.com/test)
-	"host",          // resource host (example.com)
-	"scheme",        // resource scheme (http/https/etc)
-	"text",          // resource html-stripped body
-	"html",          // resource html
-	"code",          // resource status code (e.g. 200, 500, etc)
-	"headers",       // resource headers in string form (tested against each one, being "Header: value")
-	"asset_url",     // asset (js/css/img/png) url
-	"asset_scheme",  // asset scheme (http/https/etc)
-	"asset_code",    // asset status code (e.g. 200, 500, etc)
-	"asset_headers", // asset headers in string form
+	"url",             // resource url (https://example.com/test)
+	"host",            // resource host (example.com)
+	"scheme",          // resource scheme (http/https/etc)
+	"text",            // resource html-stripped body
+	"html",            // resource html
+	"code",            // resource status code (e.g. 200, 500, etc)
+	"headers",         // resource headers in string form (tested against each one, being "Header: value")
+	"asset_url",       // asset (js/css/img/png) url
+	"asset_scheme",    // asset scheme (http/https/etc)
+	"asset_code",      // asset status code (e.g. 200, 500, etc)
+	"asset_headers",   // asset headers in string form
+	"asset_kind",      // asset kind (script, style, image, font, media, frame or other)
+	"asset_kind_code", // asset kind and status code, in the form "KIND:CODE" (e.g. "font:404")
+	"broken_links",    // number of broken <a href> links within the resource (requires --check-links)
+	"dns_time",        // time (in ms) it took to resolve the hostname of the resource
+	"connect_time",    // time (in ms) it took to connect to the server of the resource
+	"tls_time",        // time (in ms) it took to complete the TLS handshake of the resource
+	"ttfb",            // time (in ms) between sending the request and the first byte of the response
+	"transfer_time",   // time (in ms) it took to read the body of the resource
+	"tls_version",     // negotiated TLS protocol version (e.g. "TLS 1.2")
+	"tls_cipher",      // negotiated TLS cipher suite (e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	"tls_alpn",        // protocol negotiated with ALPN (e.g. "h2")
+	"cert_days_left",  // days until the certificate expires (negative if it has expired)
+	"cert_issuer",     // certificate issuer common name and organization
+	"cert_chain",      // "complete" if the certificate chains up to a trusted root, otherwise "incomplete", "untrusted" or "invalid"
+	"cert_hostname",   // "match" if the certificate is valid for the hostname, otherwise "mismatch"
+	"mixed_content",   // kind of mixed content (http asset on an https page) of each mixed asset ("active" or "passive")
+
+	// security headers, which are "missing" if not set.
+	"hsts",                 // normalized Strict-Transport-Security policy (e.g. "max-age=31536000; includesubdomains"), https only
+	"hsts_max_age",         // Strict-Transport-Security max-age, in seconds
+	"csp",                  // each Content-Security-Policy directive (e.g. "script-src 'self'")
+	"csp_script_src",       // each source allowed to load scripts by the Content-Security-Policy (e.g. "'unsafe-inline'")
+	"frame_options",        // X-Frame-Options value (e.g. "DENY"), or "frame-ancestors" if set through the Content-Security-Policy
+	"content_type_options", // "nosniff" if X-Content-Type-Options is set correctly
+	"referrer_policy",      // Referrer-Policy (e.g. "same-origin")
+	"cookie_flags",         // flags of each cookie (e.g. "session: secure=true httponly=false samesite=lax")
 }
 
+// severities are the valid severities of a test.
+var severities = []string{"info", "low", "medium", "high", "critical"}
+
 // Test represents a type of check, comparing is the resource matches
 // specific inputs.
 type Test struct {
@@ -49,6 +78,9 @@ type Test struct {
 	RawMatch    []string `json:"match"`     // list of glob/regex matches that any can match (OR)
 	RawMatchAll []string `json:"match_all"` // list of glob/regex matches that all must match (AND)
 
+	Severity    string `json:"severity"`    // how severe the problem is (see severities), if the test is a finding
+	Remediation string `json:"remediation"` // how to fix the problem, if the test is a finding
+
 	Origin   string       // where the test originated from
 	Match    []*TestMatch // the generated list of OR matches
 	MatchAll []*TestMatch // the generated list of AND matches
@@ -71,19 +103,20 @@ func (m *TestMatch) String() string {
 	return fmt.Sprintf("<type:%s against:%s query:%s>", m.Type, m.Against, m.Query)
 }
 
-// Compare matches data against TestMatch.Query.
-func (m *TestMatch) Compare(data []string) (matched int) {
+// Compare matches data against TestMatch.Query, returning the items of
+// data which matched.
+func (m *TestMatch) Compare(data []string) (matched []string) {
 	if m.Type == "glob" {
 		for i := 0; i < len(data); i++ {
 			if utils.Glob(data[i], m.Query) {
-				matched++
+				matched = append(matched, data[i])
 			}
 		}
 	} else {
 		// Assume regex based.
 		for i := 0; i < len(data); i++ {
 			if m.Regex.MatchString(data[i]) {
-				matched++
+				matched = append(matched, data[i])
 			}
 		}
 	}
@@ -151,6 +184,21 @@ func StrToMatch(test *Test, rawMatch string) (*TestMatch, error) {
 	return match, nil
 }
 
+// validSeverity returns true if severity is one of severities, or empty.
+func validSeverity(severity string) bool {
+	if severity == "" {
+		return true
+	}
+
+	for _, valid := range severities {
+		if severity == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
 // parseTests parses a json object or array from a byte array (file, url, etc).
 func parseTests(raw []byte, originType, origin string) (tests []*Test, err error) {
 	tmp := []*Test{}
@@ -171,6 +219,11 @@ func parseTests(raw []byte, originType, origin string) (tests []*Test, err error
 
 	for i := range tmp {
 		tmp[i].Origin = fmt.Sprintf("%s:%s", originType, origin)
+
+		if !validSeverity(tmp[i].Severity) {
+			return nil, fmt.Errorf("unable to parse test %s: invalid 'severity': %s (must be one of: %s)", tmp[i], tmp[i].Severity, strings.Join(severities, ", "))
+		}
+
 		tests = append(tests, tmp[i])
 	}
 
@@ -291,6 +344,18 @@ func genTestsFromStd(tests *[]*Test) {
 				continue
 			}
 
+			if strings.HasPrefix(fns[i], "data/tests/security/") && !conf.scan.SecurityTests {
+				continue
+			}
+
+			if strings.HasPrefix(fns[i], "data/tests/performance/") && !conf.scan.PerformanceTests {
+				continue
+			}
+
+			if strings.HasPrefix(fns[i], "data/tests/tls/") && !conf.scan.TLSTests {
+				continue
+			}
+
 			file, err := Asset(fns[i])
 			if err != nil {
 				out.Fatalf("unable to load asset from file %s: %s", fns[i], err)
@@ -432,6 +497,12 @@ func checkTests(results []*scraper.FetchResult, tests []*Test) []*TestResult {
 	logger.Printf("finished tests, elapsed time: %ds\n", timer.Result.Seconds)
 
 	for i := 0; i < len(completedTests); i++ {
+		for _, page := range completedTests[i].Pages {
+			if page.Result.Error == nil && page.Score < conf.scan.MinScore {
+				page.Result.Error = errors.New(page.FailedTests())
+			}
+		}
+
 		if completedTests[i].Result.Error != nil {
 			continue
 		}
@@ -450,6 +521,26 @@ type TestResult struct {
 	Score        float64              // Resulting score, skewed off defaultScore.
 	MatchedTests map[string]float64   // Map of negative affecting tests that were applied.
 	TestCount    map[string]int       // Map of times the negative affecting tests matched.
+	Pages        []*TestResult        `json:"-"` // Results of each spidered page, if spidering.
+	Findings     []*Finding           // Tests with a severity which matched (e.g. security tests).
+}
+
+// Finding is a test with a severity (e.g. a security test) which matched.
+type Finding struct {
+	Test        string   // Name of the test.
+	Severity    string   // How severe the problem is (see severities).
+	Remediation string   // How to fix the problem.
+	Matched     []string // What the test matched against.
+}
+
+// Meta returns the metadata of the domain (e.g. the owning user, document
+// root, or config file), if any. See domfinder.Domain.Meta.
+func (r *TestResult) Meta() map[string]string {
+	if r.Result == nil || r.Result.Request == nil {
+		return nil
+	}
+
+	return r.Result.Request.Meta
 }
 
 func (r *TestResult) FailedTests() string {
@@ -463,6 +554,17 @@ func (r *TestResult) FailedTests() string {
 		failed = append(failed, k)
 	}
 
+	for _, page := range r.Pages {
+		reason := page.FailedTests()
+		if page.Result.Error != nil {
+			reason = page.Result.Error.Error()
+		}
+
+		if reason != "" {
+			failed = append(failed, fmt.Sprintf("page %s: %s", page.Result.Request.URL.RequestURI(), reason))
+		}
+	}
+
 	return strings.Join(failed, ", ")
 }
 
@@ -486,11 +588,43 @@ func (res *TestResult) applyScore(test *Test, data []string, multiplier int) {
 	}
 	res.TestCount[test.Name] += multiplier
 
+	if len(test.Severity) > 0 {
+		res.addFinding(test, data)
+	}
+
 	logger.Printf("applied test %s score against %s to: %.2f (now %.2f). matched: %q\n", test, res.Result.Response.URL, test.Weight, res.Score, matched)
 }
 
+// addFinding records test as a finding, or adds to the existing finding if
+// the test already matched.
+func (res *TestResult) addFinding(test *Test, data []string) {
+	for _, finding := range res.Findings {
+		if finding.Test == test.Name {
+			finding.Matched = append(finding.Matched, data...)
+			return
+		}
+	}
+
+	res.Findings = append(res.Findings, &Finding{
+		Test:        test.Name,
+		Severity:    test.Severity,
+		Remediation: test.Remediation,
+		Matched:     data,
+	})
+}
+
 var reHTMLTag = regexp.MustCompile(`<[^>]+>`)
 
+// hostForms returns host, along with its Unicode form if it's an
+// internationalized domain, so tests can match against either.
+func hostForms(host string) []string {
+	if unicode := utils.ToUnicode(host); unicode != host {
+		return []string{host, unicode}
+	}
+
+	return []string{host}
+}
+
 // TestCompare returns what input match type should compare against.
 func TestCompare(dom *scraper.FetchResult, test *Test, mtype string) (out []string) {
 	bodyNoHTML := reHTMLTag.ReplaceAllString(dom.Response.Body, "")
@@ -503,10 +637,10 @@ func TestCompare(dom *scraper.FetchResult, test *Test, mtype string) (out []stri
 			out = append(out, dom.Assets[i].Response.URL.String())
 		}
 	case "host":
-		out = append(out, dom.Response.URL.Host)
+		out = append(out, hostForms(dom.Response.URL.Host)...)
 	case "asset_host":
 		for i := 0; i < len(dom.Assets); i++ {
-			out = append(out, dom.Assets[i].Response.URL.Host)
+			out = append(out, hostForms(dom.Assets[i].Response.URL.Host)...)
 		}
 	case "scheme":
 		out = append(out, dom.Response.URL.Scheme)
@@ -536,6 +670,36 @@ func TestCompare(dom *scraper.FetchResult, test *Test, mtype string) (out []stri
 
 			out = append(out, hv)
 		}
+	case "broken_links":
+		out = append(out, strconv.Itoa(len(dom.BrokenLinks())))
+	case "dns_time", "connect_time", "tls_time", "ttfb", "transfer_time":
+		if timings := dom.Response.Timings; timings != nil {
+			out = append(out, strconv.FormatInt(map[string]int64{
+				"dns_time":      timings.DNS,
+				"connect_time":  timings.Connect,
+				"tls_time":      timings.TLS,
+				"ttfb":          timings.TTFB,
+				"transfer_time": timings.Transfer,
+			}[mtype], 10))
+		}
+	case "tls_version", "tls_cipher", "tls_alpn", "cert_days_left", "cert_issuer", "cert_chain", "cert_hostname":
+		out = append(out, tlsCompare(dom.Response.TLS, mtype)...)
+	case "asset_kind":
+		for i := 0; i < len(dom.Assets); i++ {
+			out = append(out, dom.Assets[i].Kind)
+		}
+	case "hsts", "hsts_max_age", "csp", "csp_script_src", "frame_options", "content_type_options", "referrer_policy", "cookie_flags":
+		out = append(out, securityCompare(dom, mtype)...)
+	case "mixed_content":
+		for i := 0; i < len(dom.Assets); i++ {
+			if dom.Assets[i].Mixed != "" {
+				out = append(out, dom.Assets[i].Mixed)
+			}
+		}
+	case "asset_kind_code":
+		for i := 0; i < len(dom.Assets); i++ {
+			out = append(out, dom.Assets[i].Kind+":"+strconv.Itoa(dom.Assets[i].Response.Code))
+		}
 	case "asset_headers":
 		for i := 0; i < len(dom.Assets); i++ {
 			for name, values := range dom.Assets[i].Response.Headers {
@@ -549,14 +713,130 @@ func TestCompare(dom *scraper.FetchResult, test *Test, mtype string) (out []stri
 	return out
 }
 
+// securityCompare returns what security header related match types should
+// compare against.
+func securityCompare(dom *scraper.FetchResult, mtype string) (out []string) {
+	sec := dom.Response.Security()
+
+	switch mtype {
+	case "hsts":
+		// browsers ignore Strict-Transport-Security over http.
+		if dom.Response.URL.Scheme != "https" {
+			break
+		}
+
+		if sec.HSTS == nil {
+			out = append(out, "missing")
+		} else {
+			out = append(out, sec.HSTS.String())
+		}
+	case "hsts_max_age":
+		if sec.HSTS != nil && dom.Response.URL.Scheme == "https" {
+			out = append(out, strconv.FormatInt(sec.HSTS.MaxAge, 10))
+		}
+	case "csp":
+		if sec.CSP == nil {
+			out = append(out, "missing")
+			break
+		}
+
+		for name, sources := range sec.CSP.Directives {
+			out = append(out, strings.TrimSpace(name+" "+strings.Join(sources, " ")))
+		}
+	case "csp_script_src":
+		if sec.CSP != nil {
+			out = append(out, sec.CSP.Sources("script-src")...)
+		}
+	case "frame_options":
+		if sec.FrameOptions != "" {
+			out = append(out, sec.FrameOptions)
+		}
+
+		if sec.CSP != nil && sec.CSP.Directives["frame-ancestors"] != nil {
+			out = append(out, "frame-ancestors")
+		}
+
+		if len(out) == 0 {
+			out = append(out, "missing")
+		}
+	case "content_type_options":
+		if sec.ContentTypeOptions == "nosniff" {
+			out = append(out, sec.ContentTypeOptions)
+		} else {
+			out = append(out, "missing")
+		}
+	case "referrer_policy":
+		if sec.ReferrerPolicy != "" {
+			out = append(out, sec.ReferrerPolicy)
+		} else {
+			out = append(out, "missing")
+		}
+	case "cookie_flags":
+		for _, cookie := range sec.Cookies {
+			sameSite := cookie.SameSite
+			if sameSite == "" {
+				sameSite = "unset"
+			}
+
+			out = append(out, fmt.Sprintf("%s: secure=%t httponly=%t samesite=%s", cookie.Name, cookie.Secure, cookie.HttpOnly, sameSite))
+		}
+	}
+
+	return out
+}
+
+// tlsCompare returns what TLS related match types should compare against.
+// Nothing is returned if the resource wasn't loaded over TLS.
+func tlsCompare(ssl *scraper.TLSResponse, mtype string) (out []string) {
+	if ssl == nil {
+		return nil
+	}
+
+	switch mtype {
+	case "tls_version":
+		out = append(out, ssl.Version)
+	case "tls_cipher":
+		out = append(out, ssl.CipherSuite)
+	case "tls_alpn":
+		if ssl.NegotiatedProtocol != "" {
+			out = append(out, ssl.NegotiatedProtocol)
+		}
+	}
+
+	if len(ssl.PeerCertificates) == 0 {
+		return out
+	}
+
+	switch mtype {
+	case "cert_days_left":
+		out = append(out, strconv.Itoa(ssl.DaysLeft))
+	case "cert_issuer":
+		for _, name := range []string{ssl.PeerCertificates[0].Issuer.CommonName, ssl.PeerCertificates[0].Issuer.Organization} {
+			if name != "" {
+				out = append(out, name)
+			}
+		}
+	case "cert_chain":
+		out = append(out, ssl.ChainStatus)
+	case "cert_hostname":
+		if ssl.HostnameMatch {
+			out = append(out, "match")
+		} else {
+			out = append(out, "mismatch")
+		}
+	}
+
+	return out
+}
+
 // TestMatch compares the input test match parameters with the domain.
 func (res *TestResult) TestMatch(dom *scraper.FetchResult, test *Test) {
 	if len(test.Match) > 0 {
 		for i := 0; i < len(test.Match); i++ {
 			data := TestCompare(dom, test, test.Match[i].Against)
 
-			if matched := test.Match[i].Compare(data); matched > 0 {
-				res.applyScore(test, data, matched)
+			if matched := test.Match[i].Compare(data); len(matched) > 0 {
+				res.applyScore(test, matched, len(matched))
 			}
 		}
 	}
@@ -566,11 +846,12 @@ func (res *TestResult) TestMatch(dom *scraper.FetchResult, test *Test) {
 		for i := 0; i < len(test.MatchAll); i++ {
 			data := TestCompare(dom, test, test.MatchAll[i].Against)
 
-			if matched := test.MatchAll[i].Compare(data); matched == 0 {
+			matched := test.MatchAll[i].Compare(data)
+			if len(matched) == 0 {
 				return // Skip right to the end, no sense in continuing.
 			}
 
-			alldata = append(alldata, data...)
+			alldata = append(alldata, matched...)
 		}
 
 		// Assume each was matched properly.
@@ -615,5 +896,16 @@ func checkDomain(dom *scraper.FetchResult, tests []*Test) *TestResult {
 		}
 	}
 
+	// each spidered page is tested on its own, and the domain is only as
+	// healthy as its worst page.
+	for _, page := range dom.Pages {
+		pageRes := checkDomain(page, tests)
+		res.Pages = append(res.Pages, pageRes)
+
+		if pageRes.Score < res.Score {
+			res.Score = pageRes.Score
+		}
+	}
+
 	return res
 }
@@ -14,7 +14,6 @@ import (
 	"github.com/jroimartin/gocui"
 	"github.com/lrstanley/marill/domfinder"
 	"github.com/lrstanley/marill/scraper"
-	"github.com/lrstanley/marill/utils"
 )
 
 // mMenu holds X/Y coords of the menu for calculation from other views
@@ -482,8 +481,14 @@ func uiFindDomains(gooey *gocui.Gui, view *gocui.View) error {
 		return err
 	}
 
+	filter, err := domainFilter()
+	if err != nil {
+		return err
+	}
+	menu.scan.finder.Filter(filter)
+
 	// print the number of domains to the summary
-	out.Printf("Found %d domains on webserver %s (exe: %s, pid: %s)", len(menu.scan.finder.Domains), menu.scan.finder.MainProc.Name, menu.scan.finder.MainProc.Exe, menu.scan.finder.MainProc.PID)
+	out.Printf("Found %d domains from sources: %s", len(menu.scan.finder.Domains), strings.Join(menu.scan.finder.UsedSources, ", "))
 
 	// print the collected IP's and domains to the domains view
 	for _, domain := range menu.scan.finder.Domains {
@@ -497,7 +502,7 @@ func uiFindDomains(gooey *gocui.Gui, view *gocui.View) error {
 
 // uiReadDomains scrapes IP's/domains (hosts file format) from the domains view and loads them for the scraper
 func uiReadDomains(gooey *gocui.Gui, view *gocui.View) error {
-	var doms []*scraper.Domain
+	var domains []*domfinder.Domain
 
 	// Read the domains view to a string.  Split each line of that string into a string slice.
 	hosts := menu.domains.Buffer()
@@ -510,29 +515,45 @@ func uiReadDomains(gooey *gocui.Gui, view *gocui.View) error {
 		// if there are less than two entries, skip it
 		if len(entries) >= 2 {
 
-			// TODO: regex to verify that's an IP
 			// first entry *should* be the IP
 			ip := entries[0]
 
 			// run through the rest of the entries and tie them to the IP
 			for i, entry := range entries {
 				if i != 0 {
-
-					// TODO: regex to verify it's a real domain
-					// TODO: ports?
-					uri, err := utils.IsDomainURL(entry, "")
+					dom, err := domfinder.NewManualDomain(entry, ip, "")
 					if err != nil {
 						return err
 					}
 
-					// add each ip/domain to the scaper
-					dom := scraper.Domain{IP: ip, URL: uri}
-					doms = append(doms, &dom)
+					// keep the metadata of domains which were found via the
+					// domain search, so they can be filtered the same way.
+					for _, found := range menu.scan.finder.Domains {
+						if found.URL.String() == dom.URL.String() {
+							meta := *found
+							meta.IP = dom.IP
+							dom = &meta
+							break
+						}
+					}
+
+					domains = append(domains, dom)
 				}
 			}
 		}
 	}
 
+	filter, err := domainFilter()
+	if err != nil {
+		return err
+	}
+
+	// add each ip/domain to the scaper
+	var doms []*scraper.Domain
+	for _, dom := range domfinder.FilterDomains(domains, filter) {
+		doms = append(doms, &scraper.Domain{IP: dom.IP, URL: dom.URL, Meta: dom.Meta()})
+	}
+
 	// set scraper domains in the scanner
 	menu.scan.crawler.Cnf.Domains = doms
 	return nil
@@ -544,14 +565,6 @@ func uiCrawl(gooey *gocui.Gui, view *gocui.View) error {
 		return err
 	}
 
-	// ensure configurations are loaded
-	menu.scan.finder.Filter(domfinder.DomainFilter{
-		IgnoreHTTP:  conf.scan.IgnoreHTTP,
-		IgnoreHTTPS: conf.scan.IgnoreHTTPS,
-		IgnoreMatch: conf.scan.IgnoreMatch,
-		MatchOnly:   conf.scan.MatchOnly,
-	})
-
 	// Start the crawl in a goroutine so it doesn't cause the UI to hang.  This also allows
 	// sending periodic updates, for those long-running tests.
 	go func() {
@@ -736,7 +749,7 @@ func uiInit() error {
 
 	menu.scan = &Scan{}
 	menu.scan.tests = genTests()
-	menu.scan.finder = &domfinder.Finder{Log: logger}
+	menu.scan.finder = newFinder()
 	menu.scan.crawler = &scraper.Crawler{Log: logger}
 
 	gooey.SetLayout(uiLayout)
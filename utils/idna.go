@@ -0,0 +1,57 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ToASCII converts an internationalized domain name (e.g. "bücher.de") to its
+// punycode form (e.g. "xn--bcher-kva.de"), as used within DNS and the Host
+// header. Domains which are already ASCII are returned as-is.
+func ToASCII(host string) (string, error) {
+	out, err := idna.ToASCII(strings.ToLower(host))
+	if err != nil {
+		return "", fmt.Errorf("unable to convert %q to punycode: %s", host, err)
+	}
+
+	if out == strings.ToLower(host) {
+		return host, nil
+	}
+
+	return out, nil
+}
+
+// ToUnicode converts a punycode domain (e.g. "xn--bcher-kva.de") to its
+// Unicode form (e.g. "bücher.de"). Domains which cannot be decoded are left
+// as-is.
+func ToUnicode(host string) string {
+	out, err := idna.ToUnicode(strings.ToLower(host))
+	if err != nil || out == strings.ToLower(host) {
+		return host
+	}
+
+	return out
+}
+
+// UnicodeURL returns uri with its hostname in Unicode form, or an empty
+// string if uri isn't an internationalized domain.
+func UnicodeURL(uri *url.URL) string {
+	if uri == nil {
+		return ""
+	}
+
+	host := ToUnicode(uri.Host)
+	if host == uri.Host {
+		return ""
+	}
+
+	// url.String() would percent-encode the Unicode hostname.
+	return strings.Replace(uri.String(), uri.Host, host, 1)
+}
@@ -0,0 +1,59 @@
+// Author: Liam Stanley <me@liamstanley.io>
+// Docs: https://marill.liam.sh/
+// Repo: https://github.com/lrstanley/marill
+
+package utils
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestIDNA(t *testing.T) {
+	cases := []struct {
+		unicode string
+		ascii   string
+	}{
+		{"example.com", "example.com"},
+		{"bücher.de", "xn--bcher-kva.de"},
+		{"münchen.example.com:8080", "xn--mnchen-3ya.example.com:8080"},
+	}
+
+	for _, c := range cases {
+		if out, err := ToASCII(c.unicode); err != nil || out != c.ascii {
+			t.Fatalf("ToASCII(%q) == (%q, %v), wanted %q", c.unicode, out, err, c.ascii)
+		}
+
+		if out := ToUnicode(c.ascii); out != c.unicode {
+			t.Fatalf("ToUnicode(%q) == %q, wanted %q", c.ascii, out, c.unicode)
+		}
+	}
+
+	// invalid punycode is left as-is.
+	if out := ToUnicode("xn--!!.com"); out != "xn--!!.com" {
+		t.Fatalf("ToUnicode(%q) == %q, wanted it unchanged", "xn--!!.com", out)
+	}
+
+	return
+}
+
+func TestUnicodeURL(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"http://example.com/", ""},
+		{"https://xn--bcher-kva.de/path?q=1", "https://bücher.de/path?q=1"},
+		{"http://xn--mnchen-3ya.example.com:8080", "http://münchen.example.com:8080"},
+	}
+
+	for _, c := range cases {
+		uri, _ := url.Parse(c.in)
+
+		if out := UnicodeURL(uri); out != c.want {
+			t.Fatalf("UnicodeURL(%q) == %q, wanted %q", c.in, out, c.want)
+		}
+	}
+
+	return
+}
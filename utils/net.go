@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -25,19 +26,36 @@ func GetHost(uri string) (string, error) {
 	return host.Host, nil
 }
 
+// IsIP returns true if host is an IPv4 or IPv6 address. IPv6 addresses may be
+// enclosed in brackets, as they are within urls (e.g. "[2001:db8::1]").
+func IsIP(host string) bool {
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")) != nil
+}
+
 const (
 	kernHostname = "/proc/sys/kernel/hostname"
 	kernDomain   = "/proc/sys/kernel/domainname"
+	etcHostname  = "/etc/hostname"
 	stdPort      = "80"
 	sslPort      = "443"
+	altSSLPort   = "8443"
 )
 
 // GetHostname returns the servers hostname which we should compare against webserver
-// vhost entries. Also includes domain.
-func GetHostname() string {
-	host, herr := ioutil.ReadFile(kernHostname)
-	domain, derr := ioutil.ReadFile(kernDomain)
+// vhost entries. Also includes domain. root is the filesystem root which the
+// hostname is read from (e.g. a captured snapshot of a server), or "" for the
+// running system.
+func GetHostname(root string) string {
+	host, herr := ioutil.ReadFile(filepath.Join(root, kernHostname))
+	domain, derr := ioutil.ReadFile(filepath.Join(root, kernDomain))
 	if herr != nil || derr != nil {
+		// snapshots commonly won't include /proc, so try /etc/hostname.
+		if root != "" {
+			if host, herr = ioutil.ReadFile(filepath.Join(root, etcHostname)); herr == nil {
+				return strings.TrimSpace(string(host))
+			}
+		}
+
 		return "unknown"
 	}
 
@@ -60,6 +78,11 @@ func IsDomainURL(host, port string) (*url.URL, error) {
 	}
 
 	if !strings.HasPrefix(host, "http") {
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			// ipv6 hosts need to be enclosed in brackets within urls.
+			host = "[" + host + "]"
+		}
+
 		if port != sslPort && port != stdPort && port != "" {
 			host = fmt.Sprintf("%s:%s", host, port)
 		}
@@ -99,10 +122,10 @@ func IsDomainURL(host, port string) (*url.URL, error) {
 		}
 	} else {
 		// lets try and determine the scheme we need. Best solution would like be:
-		//   - 443 -- https
+		//   - 443/8443 -- https
 		//   - anything else -- http
 		var scheme string
-		if port == sslPort {
+		if port == sslPort || port == altSSLPort {
 			scheme = "https://"
 		} else {
 			scheme = "http://"
@@ -115,6 +138,11 @@ func IsDomainURL(host, port string) (*url.URL, error) {
 		}
 	}
 
+	// internationalized domains are always requested in their punycode form.
+	if uri.Host, err = ToASCII(uri.Host); err != nil {
+		return nil, err
+	}
+
 	return uri, nil
 }
 
@@ -40,12 +40,40 @@ func TestGetHostname(t *testing.T) {
 		t.Fatalf("os.Hostname() returned: %q", err)
 	}
 
-	newHost := GetHostname()
+	newHost := GetHostname("")
 
 	if !strings.HasPrefix(newHost, host) {
 		t.Fatalf("getHostname() == %q, wanted prefix: %q", newHost, host)
 	}
 
+	if snapHost := GetHostname("testdata/root"); snapHost != "web42.example.com" {
+		t.Fatalf("getHostname(%q) == %q, wanted %q", "testdata/root", snapHost, "web42.example.com")
+	}
+
+	return
+}
+
+func TestIsIP(t *testing.T) {
+	cases := []struct {
+		in   string
+		want bool
+	}{
+		{"1.2.3.4", true},
+		{"2001:db8::1", true},
+		{"[2001:db8::1]", true},
+		{"::", true},
+		{"1.2.3.4.5", false},
+		{"[1.2.3.4]:80", false},
+		{"domain.com", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		if out := IsIP(c.in); out != c.want {
+			t.Fatalf("IsIP(%q) == %t, wanted %t", c.in, out, c.want)
+		}
+	}
+
 	return
 }
 
@@ -61,8 +89,15 @@ func TestIsDomainURL(t *testing.T) {
 		{host: "domain.com", port: "80", want: "http://domain.com"},
 		{host: "domain.com", port: "443", want: "https://domain.com"},
 		{host: "domain.com", port: "8080", want: "http://domain.com:8080"},
+		{host: "domain.com", port: "8443", want: "https://domain.com:8443"},
+		{host: "http://domain.com", port: "8443", want: "http://domain.com:8443"},
 		{host: "domain.com", port: "0123", want: ""},
 		{host: "domain.com", port: "", want: "http://domain.com"},
+		{host: "2001:db8::1", port: "443", want: "https://[2001:db8::1]"},
+		{host: "2001:db8::1", port: "8080", want: "http://[2001:db8::1]:8080"},
+		{host: "https://[::1]", port: "8443", want: "https://[::1]:8443"},
+		{host: "bücher.de", port: "443", want: "https://xn--bcher-kva.de"},
+		{host: "http://bücher.de/pfad", port: "8080", want: "http://xn--bcher-kva.de:8080/pfad"},
 	}
 
 	for _, c := range cases {